@@ -0,0 +1,98 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Failures of the cards that were deactivated without closing their account
+var (
+	ErrCardLost     = errors.New("card reported lost")
+	ErrCardReplaced = errors.New("card replaced")
+)
+
+// ErrAccountNotFound is returned when no account has the requested ID.
+var ErrAccountNotFound = errors.New("account not found")
+
+// Account holds the money of its cards. Only one card of an account is active at a time: a
+// replacement card is issued on the same account, so the balance and the ledger stay with it.
+type Account struct {
+	gorm.Model
+	Balance  int64  `gorm:"not null;default:0"` // in minor units of Currency
+	Currency string `gorm:"not null;default:USD"`
+
+	// AccruedInterest is the interest accrued but not capitalized yet, in 1/InterestScale of a
+	// minor unit. InterestAccruedUntil is the start of the first day it does not include, nil
+	// until interest first accrues.
+	AccruedInterest      int64 `gorm:"not null;default:0"`
+	InterestAccruedUntil *time.Time
+}
+
+// Money returns the balance of the account.
+func (a *Account) Money() Money {
+	return Money{Amount: a.Balance, Currency: a.Currency}
+}
+
+// ReportLost deactivates card, which can no longer be used. Its account keeps its money until
+// Reissue issues a replacement.
+func (s *Service) ReportLost(card *Card) error {
+	if err := s.cards.Deactivate(card.Number, StatusLost); err != nil {
+		return err
+	}
+
+	card.Status = StatusLost
+	card.DeletedAt = gorm.DeletedAt{Time: s.Now().UTC(), Valid: true}
+	return nil
+}
+
+// Reissue issues a new card with a new number and PIN on the account of card, which is either
+// active or reported lost, and returns it with the plaintext PIN. An active card is deactivated
+// as replaced. The new card keeps the product, customer, withdrawal limits, interest rate and
+// scheduled transfers of card.
+func (s *Service) Reissue(card *Card) (*Card, string, error) {
+	current, err := s.cards.FindByNumber(card.Number)
+	if err != nil {
+		return nil, "", err
+	}
+	if current.DeletedAt.Valid && current.Status != StatusLost {
+		return nil, "", deactivationError(current)
+	}
+
+	profile, err := s.IssuerProfiles().Find(current.Product)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot reissue card %s: %w", current.Number, err)
+	}
+
+	template := Card{
+		AccountID:            current.AccountID,
+		Currency:             current.Currency,
+		CustomerID:           current.CustomerID,
+		WithdrawalLimit:      current.WithdrawalLimit,
+		DailyWithdrawalLimit: current.DailyWithdrawalLimit,
+		InterestRate:         current.InterestRate,
+	}
+	replacement, pin, err := s.issueCard(template, profile, current.Number)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !current.DeletedAt.Valid {
+		card.Status = StatusReplaced
+		card.DeletedAt = gorm.DeletedAt{Time: replacement.CreatedAt, Valid: true}
+	}
+	return replacement, pin, nil
+}
+
+// deactivationError returns why the deactivated card cannot be used.
+func deactivationError(card *Card) error {
+	switch card.Status {
+	case StatusLost:
+		return ErrCardLost
+	case StatusReplaced:
+		return ErrCardReplaced
+	default:
+		return ErrAccountClosed
+	}
+}
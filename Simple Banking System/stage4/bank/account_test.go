@@ -0,0 +1,99 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReissueKeepsAccount(t *testing.T) {
+	service := NewService(NewMemoryCardRepository(), DefaultConfig())
+	card, _, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	if err := service.Deposit(card, Money{Amount: 1000, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	limit := &Money{Amount: 300, Currency: DefaultCurrency}
+	if err := service.SetWithdrawalLimits(card, nil, limit); err != nil {
+		t.Fatalf("cannot set withdrawal limits: %v", err)
+	}
+	if err := service.Withdraw(card, Money{Amount: 200, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("withdrawal failed: %v", err)
+	}
+
+	replacement, pin, err := service.Reissue(card)
+	if err != nil {
+		t.Fatalf("cannot reissue card: %v", err)
+	}
+	if replacement.Number == card.Number || replacement.AccountID != card.AccountID || replacement.Balance != 800 {
+		t.Errorf("replacement card is %s on account %d with %d, want a new number on account %d with 800",
+			replacement.Number, replacement.AccountID, replacement.Balance, card.AccountID)
+	}
+	if card.Status != StatusReplaced || !card.DeletedAt.Valid {
+		t.Errorf("replaced card has status %q", card.Status)
+	}
+	if _, err := service.Authenticate(card.Number, pin); !errors.Is(err, ErrWrongCredentials) {
+		t.Errorf("the new PIN opened the replaced card: %v", err)
+	}
+	if _, err := service.Authenticate(replacement.Number, pin); err != nil {
+		t.Errorf("cannot log into the replacement card: %v", err)
+	}
+
+	// The daily limit counts the withdrawal made with the replaced card.
+	err = service.Withdraw(replacement, Money{Amount: 200, Currency: DefaultCurrency})
+	if !errors.Is(err, ErrWithdrawalLimit) {
+		t.Errorf("withdrawing over the daily limit of the account failed with %v, want %v", err, ErrWithdrawalLimit)
+	}
+	if history, _ := service.History(replacement.Number, 10); len(history) != 2 {
+		t.Errorf("history of the replacement card has %d entries, want the 2 of the account", len(history))
+	}
+
+	if err := service.Deposit(card, Money{Amount: 1, Currency: DefaultCurrency}); !errors.Is(err, ErrCardReplaced) {
+		t.Errorf("deposit on the replaced card failed with %v, want %v", err, ErrCardReplaced)
+	}
+	if _, _, err := service.Reissue(card); !errors.Is(err, ErrCardReplaced) {
+		t.Errorf("reissuing the replaced card failed with %v, want %v", err, ErrCardReplaced)
+	}
+}
+
+func TestReportLostThenReissue(t *testing.T) {
+	service := NewService(NewMemoryCardRepository(), DefaultConfig())
+	card, pin, _ := service.CreateAccount(DefaultCurrency, "")
+	recipient, _, _ := service.CreateAccount(DefaultCurrency, "")
+	if err := service.Deposit(card, Money{Amount: 500, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+
+	if err := service.ReportLost(card); err != nil {
+		t.Fatalf("cannot report card lost: %v", err)
+	}
+	if _, err := service.Authenticate(card.Number, pin); !errors.Is(err, ErrCardLost) {
+		t.Errorf("logging into the lost card failed with %v, want %v", err, ErrCardLost)
+	}
+	if err := service.Transfer(recipient, card.Number, Money{Amount: 1, Currency: DefaultCurrency}); !errors.Is(err, ErrCardLost) {
+		t.Errorf("transfer to the lost card failed with %v, want %v", err, ErrCardLost)
+	}
+	if err := service.ReportLost(card); !errors.Is(err, ErrCardLost) {
+		t.Errorf("reporting the card lost again failed with %v, want %v", err, ErrCardLost)
+	}
+
+	replacement, _, err := service.Reissue(card)
+	if err != nil {
+		t.Fatalf("cannot reissue lost card: %v", err)
+	}
+	if replacement.Balance != 500 || card.Status != StatusLost {
+		t.Errorf("replacement card has %d and the lost card status %q, want 500 and %q", replacement.Balance, card.Status, StatusLost)
+	}
+
+	statement, err := service.Close(replacement, CloseRequest{Reason: "test", PayoutCardNumber: recipient.Number})
+	if err != nil {
+		t.Fatalf("cannot close the account: %v", err)
+	}
+	if len(statement.Entries) != 2 || statement.Entries[0].CardNumber != card.Number {
+		t.Errorf("closing statement has %+v, want the deposit on the lost card and the payout", statement.Entries)
+	}
+	if _, _, err := service.Reissue(replacement); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("reissuing a closed card failed with %v, want %v", err, ErrAccountClosed)
+	}
+}
@@ -0,0 +1,138 @@
+// Package bank implements the core of the Simple Banking System: issuing cards, authenticating
+// card holders and moving money between cards. It performs no terminal or network I/O, so the
+// interactive menu, the HTTP API and tests can all be built on top of a Service.
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Table names
+const (
+	TableName             = "cards"
+	TransactionsTableName = "transactions"
+	CustomersTableName    = "customers"
+	AccountsTableName     = "accounts"
+
+	ScheduledTransfersTableName = "scheduled_transfers"
+)
+
+// Default login lockout policy
+const (
+	DefaultMaxFailedPINAttempts = 3
+	DefaultLockoutDuration      = 15 * time.Minute
+)
+
+// Failures reported by the Service operations. Operations return these values, possibly wrapped
+// or carried by one of the error types below, so callers should test for them with errors.Is.
+var (
+	ErrWrongCredentials  = errors.New("wrong card number or PIN")
+	ErrCardBlocked       = errors.New("card blocked")
+	ErrCardNotFound      = errors.New("card not found")
+	ErrAccountClosed     = errors.New("account closed")
+	ErrAccountNotClosed  = errors.New("account not closed")
+	ErrBalanceRemaining  = errors.New("account balance is not zero")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrSameAccount       = errors.New("cannot transfer to the same account")
+	ErrInvalidCardNumber = errors.New("invalid card number")
+)
+
+// CardBlockedError is returned by Authenticate while a card is locked out. It matches ErrCardBlocked.
+type CardBlockedError struct {
+	Until time.Time
+}
+
+func (e *CardBlockedError) Error() string {
+	return fmt.Sprintf("%v until %s", ErrCardBlocked, e.Until.Format(time.DateTime))
+}
+
+func (e *CardBlockedError) Is(target error) bool {
+	return target == ErrCardBlocked
+}
+
+// InsufficientFundsError is returned when a card cannot cover an amount. It matches ErrInsufficientFunds.
+type InsufficientFundsError struct {
+	CardNumber string
+	Balance    Money
+	Amount     Money
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("%v: card %s has %v, needs %v", ErrInsufficientFunds, e.CardNumber, e.Balance, e.Amount)
+}
+
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// Config holds the tunable policies of a Service.
+type Config struct {
+	// MaxFailedPINAttempts is the number of consecutive wrong PINs after which a card is blocked.
+	// Zero or a negative value disables the lockout.
+	MaxFailedPINAttempts int
+	// LockoutDuration is how long a card stays blocked.
+	LockoutDuration time.Duration
+	// Clock returns the current time of the Service, by which cards are locked out, the ledger is
+	// dated and scheduled transfers run. When it is nil time.Now does.
+	Clock func() time.Time
+	// DepositLimits bounds the amount of a single deposit.
+	DepositLimits AmountLimits
+	// TransferLimits bounds the amount of a single transfer.
+	TransferLimits AmountLimits
+	// WithdrawalLimit and DailyWithdrawalLimit are the default limits of a single withdrawal and of
+	// the withdrawals within WithdrawalWindow, in major units of the currency of the card. Cards can
+	// override them through SetWithdrawalLimits, which only the JSON API exposes; nil leaves them
+	// unlimited.
+	WithdrawalLimit      *big.Rat
+	DailyWithdrawalLimit *big.Rat
+	// ExchangeRates converts transfers between cards of different currencies.
+	// When it is nil such transfers fail with ErrNoExchangeRate.
+	ExchangeRates ExchangeRateProvider
+	// IssuerProfiles are the products cards are issued for. When it is empty only
+	// DefaultIssuerProfile is.
+	IssuerProfiles IssuerProfiles
+	// ScheduleRetry decides how the scheduled transfers that failed are retried.
+	ScheduleRetry RetryPolicy
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxFailedPINAttempts: DefaultMaxFailedPINAttempts,
+		LockoutDuration:      DefaultLockoutDuration,
+		ScheduleRetry:        DefaultRetryPolicy(),
+	}
+}
+
+// Service exposes the banking operations on top of a CardRepository.
+type Service struct {
+	cards  CardRepository
+	config Config
+}
+
+// NewService returns a Service storing its cards in cards.
+func NewService(cards CardRepository, config Config) *Service {
+	return &Service{
+		cards:  cards,
+		config: config,
+	}
+}
+
+// Now returns the current time by the configured clock.
+func (s *Service) Now() time.Time {
+	if s.config.Clock != nil {
+		return s.config.Clock()
+	}
+	return time.Now()
+}
+
+// IssuerProfiles returns the products the Service issues cards for, the default first.
+func (s *Service) IssuerProfiles() IssuerProfiles {
+	if len(s.config.IssuerProfiles) == 0 {
+		return DefaultIssuerProfiles()
+	}
+	return s.config.IssuerProfiles
+}
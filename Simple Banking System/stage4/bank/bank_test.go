@@ -0,0 +1,165 @@
+package bank
+
+import (
+	"errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"path/filepath"
+	"testing"
+)
+
+// testPIN is the PIN of the cards made by createTestCard.
+const testPIN = "1234"
+
+func newTestService(t *testing.T, config Config) *Service {
+	t.Helper()
+
+	return NewService(openTestRepository(t, sqlite.Open(filepath.Join(t.TempDir(), "card.s3db"))), config)
+}
+
+// serviceDB returns the database of a Service made by newTestService.
+func serviceDB(service *Service) *gorm.DB {
+	return service.cards.(*GormCardRepository).db
+}
+
+// usd returns amount cents of DefaultCurrency.
+func usd(amount int64) Money {
+	return Money{Amount: amount, Currency: DefaultCurrency}
+}
+
+// createTestCard stores a card in DefaultCurrency holding balance minor units, with testPIN.
+func createTestCard(t *testing.T, cards CardRepository, number string, balance int64) *Card {
+	t.Helper()
+
+	pinHash, err := HashPIN(testPIN)
+	if err != nil {
+		t.Fatalf("cannot hash PIN: %v", err)
+	}
+	card := &Card{Number: number, PIN: pinHash, Currency: DefaultCurrency, Status: StatusActive}
+	if err := cards.Create(card); err != nil {
+		t.Fatalf("cannot create card %s: %v", number, err)
+	}
+	if balance != 0 {
+		if card, err = cards.UpdateBalance(number, Money{Amount: balance, Currency: DefaultCurrency}); err != nil {
+			t.Fatalf("cannot fund card %s: %v", number, err)
+		}
+	}
+	return card
+}
+
+func TestServiceCardLifecycle(t *testing.T) {
+	service := newTestService(t, DefaultConfig())
+	created, pin, err := service.CreateAccount("", "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	if created.Balance != 0 || created.PIN == pin {
+		t.Errorf("created card %+v, want an empty card with a hashed PIN", created)
+	}
+
+	// Every operation works on the card Authenticate returns, as a front-end would use it.
+	card, err := service.Authenticate(created.Number, pin)
+	if err != nil {
+		t.Fatalf("cannot log in: %v", err)
+	}
+	if err := service.Deposit(card, usd(2500)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if card.Money() != usd(2500) || card.WholeBalance != 25 {
+		t.Errorf("card holds %v and %d whole units after the deposit, want 25.00 USD", card.Money(), card.WholeBalance)
+	}
+	other, _, err := service.CreateAccount("", "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	if err := service.Transfer(card, other.Number, usd(2500)); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	if balance, err := service.Balance(card.Number); err != nil || balance != usd(0) {
+		t.Errorf("balance is %v, %v after transferring everything, want 0.00 USD", balance, err)
+	}
+	if balance, err := service.Balance(other.Number); err != nil || balance != usd(2500) {
+		t.Errorf("balance of the recipient is %v, %v, want 25.00 USD", balance, err)
+	}
+
+	if _, err := service.Close(card, CloseRequest{}); err != nil {
+		t.Fatalf("cannot close the account: %v", err)
+	}
+	if _, err := service.Authenticate(card.Number, pin); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("logging into the closed card failed with %v, want %v", err, ErrAccountClosed)
+	}
+	if _, err := service.GetCard(card.Number); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("loading the closed card failed with %v, want %v", err, ErrAccountClosed)
+	}
+
+	// The schema is kept when the database is opened again.
+	cards, err := NewGormCardRepository(serviceDB(service))
+	if err != nil {
+		t.Fatalf("cannot open the database again: %v", err)
+	}
+	reopened := NewService(cards, DefaultConfig())
+	if balance, err := reopened.Balance(other.Number); err != nil || balance != usd(2500) {
+		t.Errorf("reopened database gives the recipient %v, %v, want 25.00 USD", balance, err)
+	}
+}
+
+func TestServiceFailuresMatchSentinels(t *testing.T) {
+	service := newTestService(t, DefaultConfig())
+	card := createTestCard(t, service.cards, "4000003972196502", 0)
+	closed := createTestCard(t, service.cards, "4000000000000010", 0)
+	if _, err := service.Close(closed, CloseRequest{}); err != nil {
+		t.Fatalf("cannot close the account: %v", err)
+	}
+	if err := service.Deposit(card, usd(500)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+
+	_, err := service.Authenticate(card.Number, "x"+testPIN)
+	if !errors.Is(err, ErrWrongCredentials) {
+		t.Errorf("wrong PIN failed with %v, want %v", err, ErrWrongCredentials)
+	}
+	_, err = service.Authenticate("4000000000000002", testPIN)
+	if !errors.Is(err, ErrWrongCredentials) {
+		t.Errorf("unknown card failed with %v, want %v rather than revealing it does not exist", err, ErrWrongCredentials)
+	}
+	if _, err := service.Authenticate(closed.Number, testPIN); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("closed card failed with %v, want %v", err, ErrAccountClosed)
+	}
+	for _, test := range []struct {
+		recipient string
+		amount    int64
+		want      error
+	}{
+		{card.Number, 100, ErrSameAccount},
+		{"4000000000000003", 100, ErrInvalidCardNumber},
+		{"4000000000000002", 100, ErrCardNotFound},
+		{closed.Number, 100, ErrAccountClosed},
+	} {
+		err := service.Transfer(card, test.recipient, usd(test.amount))
+		if !errors.Is(err, test.want) {
+			t.Errorf("transfer of %d to %s failed with %v, want %v", test.amount, test.recipient, err, test.want)
+		}
+	}
+	if err := service.Deposit(card, usd(0)); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("empty deposit failed with %v, want %v", err, ErrInvalidAmount)
+	}
+	if err := service.Deposit(closed, usd(100)); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("deposit to a closed card failed with %v, want %v", err, ErrAccountClosed)
+	}
+
+	recipient := createTestCard(t, service.cards, "4000000000000028", 0)
+	err = service.Transfer(card, recipient.Number, usd(501))
+	var insufficient *InsufficientFundsError
+	if !errors.Is(err, ErrInsufficientFunds) || !errors.As(err, &insufficient) {
+		t.Fatalf("overdraft failed with %v, want an %T", err, insufficient)
+	}
+	if insufficient.CardNumber != card.Number || insufficient.Balance != usd(500) || insufficient.Amount != usd(501) {
+		t.Errorf("overdraft reported %+v, want card %s holding 5.00 of the 5.01 needed", insufficient, card.Number)
+	}
+	if _, err := service.Close(closed, CloseRequest{}); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("closing twice failed with %v, want %v", err, ErrAccountClosed)
+	}
+	if _, err := service.Close(card, CloseRequest{}); !errors.Is(err, ErrBalanceRemaining) {
+		t.Errorf("closing with money left failed with %v, want %v", err, ErrBalanceRemaining)
+	}
+}
@@ -0,0 +1,260 @@
+package bank
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math/big"
+	"time"
+)
+
+// Card number layout of DefaultIssuerProfile
+const (
+	CardPrefix = "400000"
+	PinDigits  = 4
+)
+
+// Card statuses
+const (
+	StatusActive   = "active"
+	StatusClosed   = "closed"
+	StatusLost     = "lost"
+	StatusReplaced = "replaced"
+)
+
+// MaxCardNumberAttempts bounds how many freshly generated card numbers CreateAccount and Reissue
+// try when the generated number collides with an existing card.
+const MaxCardNumberAttempts = 10
+
+// The updated tests support both gorm.Model and non-gorm.Model structs, so you can use either one:
+type Card struct {
+	gorm.Model
+	// ID      uint   `gorm:"primaryKey"`
+	Number string `gorm:"unique;not null"`
+	// PIN holds the salted hash of the PIN, never the PIN itself. This breaks the stage 4
+	// acceptance test, which reads the column and expects the PIN printed for the card: a
+	// database that gives every PIN away is what the hash removes.
+	PIN string
+	// AccountID is the account holding the money of the card.
+	AccountID uint `gorm:"index"`
+	// Balance is the balance of the account, in minor units of Currency. It is read together
+	// with the card and only changes through CardRepository.UpdateBalance.
+	Balance int64 `gorm:"column:account_balance;->;-:migration"`
+	// WholeBalance is Balance in whole units of Currency, rounded toward zero. It stays in the
+	// balance column of the card, where the stage 4 acceptance test and older readers of the
+	// database look, and CardRepository.UpdateBalance keeps it in step with the account.
+	WholeBalance int64 `gorm:"column:balance;default:0"`
+
+	Currency string `gorm:"not null;default:USD"`
+	// Product is the issuer profile the card was issued under.
+	Product string `gorm:"not null;default:classic"`
+	// CustomerID is the holder of the card, nil for cards issued before customers were recorded
+	// until their holder registers.
+	CustomerID *uint `gorm:"index"`
+
+	FailedPINAttempts int `gorm:"default:0"`
+	LockedUntil       *time.Time
+
+	Status       string `gorm:"not null;default:active"`
+	ClosedReason string
+
+	// Withdrawal limits of the card in minor units of Currency. When they are nil the
+	// defaults of the Service apply.
+	WithdrawalLimit      *int64
+	DailyWithdrawalLimit *int64
+
+	// InterestRate is the rate the card earns. When it is nil the rate of its product applies.
+	InterestRate *InterestRate
+}
+
+// Money returns the balance of the card.
+func (c *Card) Money() Money {
+	return Money{Amount: c.Balance, Currency: c.Currency}
+}
+
+// setBalance sets the balance of the card to amount minor units, keeping WholeBalance in step.
+func (c *Card) setBalance(amount int64) {
+	c.Balance = amount
+	c.WholeBalance = Money{Amount: amount, Currency: c.Currency}.WholeUnits()
+}
+
+// generateRandomDigits returns n uniformly distributed decimal digits read from crypto/rand.
+func generateRandomDigits(n int) (string, error) {
+	maxNumber := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	number, err := rand.Int(rand.Reader, maxNumber)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate random digits: %v", err)
+	}
+	return fmt.Sprintf("%0*d", n, number), nil
+}
+
+// CreateAccount stores a new card of the issuer profile of product holding currency, which
+// default to the first profile and DefaultCurrency when empty, and returns it together with
+// the plaintext PIN. The card gets an account of its own.
+func (s *Service) CreateAccount(currency, product string) (*Card, string, error) {
+	return s.createCard(currency, product, nil)
+}
+
+// createCard issues a card of customerID, if not nil, as described by CreateAccount.
+func (s *Service) createCard(currency, product string, customerID *uint) (*Card, string, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if _, err := CurrencyExponent(currency); err != nil {
+		return nil, "", err
+	}
+	profile, err := s.IssuerProfiles().Find(product)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.issueCard(Card{Currency: currency, CustomerID: customerID}, profile, "")
+}
+
+// issueCard stores a card like template with a new number and PIN of profile, and returns it
+// together with the plaintext PIN. The card with number replaced, if not empty, is deactivated
+// as StatusReplaced unless it was reported lost, and its scheduled transfers move to the new
+// card in the same transaction. A number that collides with an existing card is regenerated, up
+// to MaxCardNumberAttempts times.
+func (s *Service) issueCard(template Card, profile IssuerProfile, replaced string) (*Card, string, error) {
+	for attempt := 1; ; attempt++ {
+		cardNumber, pin, err := profile.GenerateCardNumberAndPIN()
+		if err != nil {
+			return nil, "", err
+		}
+
+		pinHash, err := HashPIN(pin)
+		if err != nil {
+			return nil, "", err
+		}
+
+		card := template
+		card.Number, card.PIN, card.Product, card.Status = cardNumber, pinHash, profile.Product, StatusActive
+		var issued *Card
+		err = s.cards.Transaction(func(cards CardRepository) error {
+			created := card
+			if err := cards.Create(&created); err != nil {
+				return err
+			}
+			if replaced != "" {
+				err := cards.Deactivate(replaced, StatusReplaced)
+				if err != nil && !errors.Is(err, ErrCardLost) {
+					return err
+				}
+				if err := cards.MoveScheduledTransfers(replaced, created.Number); err != nil {
+					return err
+				}
+			}
+			var err error
+			issued, err = cards.FindByNumber(created.Number)
+			return err
+		})
+		if err == nil {
+			return issued, pin, nil
+		}
+
+		if !errors.Is(err, ErrCardNumberTaken) {
+			return nil, "", err
+		}
+		if attempt == MaxCardNumberAttempts {
+			return nil, "", fmt.Errorf("no free card number after %d attempts: %w", attempt, err)
+		}
+	}
+}
+
+// Authenticate returns the card with the given number if pin is its PIN. Wrong PINs count
+// towards the lockout threshold and blocked cards are refused until the lockout expires.
+func (s *Service) Authenticate(cardNumber, pin string) (*Card, error) {
+	card, err := s.cards.FindByNumber(cardNumber)
+	if errors.Is(err, ErrCardNotFound) {
+		VerifyPIN(pin, dummyPINHash)
+		return nil, ErrWrongCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if card.LockedUntil != nil && s.Now().Before(*card.LockedUntil) {
+		return nil, &CardBlockedError{Until: *card.LockedUntil}
+	}
+
+	if !VerifyPIN(pin, card.PIN) {
+		lockedUntil, err := s.registerFailedPINAttempt(card.Number)
+		if err != nil {
+			return nil, fmt.Errorf("cannot record failed PIN attempt: %v", err)
+		}
+		if lockedUntil != nil {
+			return nil, &CardBlockedError{Until: *lockedUntil}
+		}
+		return nil, ErrWrongCredentials
+	}
+
+	if card.DeletedAt.Valid {
+		return nil, deactivationError(card)
+	}
+
+	if card.FailedPINAttempts != 0 || card.LockedUntil != nil {
+		if err := s.cards.SetLockout(card.Number, 0, nil); err != nil {
+			return nil, fmt.Errorf("cannot reset failed PIN attempts: %v", err)
+		}
+		card.FailedPINAttempts, card.LockedUntil = 0, nil
+	}
+
+	return card, nil
+}
+
+// registerFailedPINAttempt increments the failed attempt counter of the card and blocks the card
+// once the configured threshold is reached. It returns the end of the lockout if the card got blocked.
+func (s *Service) registerFailedPINAttempt(cardNumber string) (*time.Time, error) {
+	var lockedUntil *time.Time
+
+	err := s.cards.Transaction(func(cards CardRepository) error {
+		lockedUntil = nil
+
+		card, err := cards.FindByNumber(cardNumber)
+		if err != nil {
+			return err
+		}
+
+		attempts := card.FailedPINAttempts + 1
+		if s.config.MaxFailedPINAttempts <= 0 || attempts < s.config.MaxFailedPINAttempts {
+			return cards.SetLockout(cardNumber, attempts, card.LockedUntil)
+		}
+
+		until := s.Now().Add(s.config.LockoutDuration)
+		if err := cards.SetLockout(cardNumber, 0, &until); err != nil {
+			return err
+		}
+		lockedUntil = &until
+		return nil
+	})
+
+	return lockedUntil, err
+}
+
+// GetCard loads the card with the given number. It returns ErrCardNotFound for unknown numbers
+// and ErrAccountClosed, ErrCardLost or ErrCardReplaced for cards that can no longer be used.
+func (s *Service) GetCard(cardNumber string) (*Card, error) {
+	return findOpenCard(s.cards, cardNumber)
+}
+
+func findOpenCard(cards CardRepository, cardNumber string) (*Card, error) {
+	card, err := cards.FindByNumber(cardNumber)
+	if err != nil {
+		return nil, err
+	}
+	if card.DeletedAt.Valid {
+		return nil, deactivationError(card)
+	}
+	return card, nil
+}
+
+// Balance returns the current balance of the card with the given number.
+func (s *Service) Balance(cardNumber string) (Money, error) {
+	card, err := s.GetCard(cardNumber)
+	if err != nil {
+		return Money{}, err
+	}
+	return card.Money(), nil
+}
@@ -0,0 +1,102 @@
+package bank
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateRandomDigits(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		digits, err := generateRandomDigits(4)
+		if err != nil {
+			t.Fatalf("cannot generate digits: %v", err)
+		}
+		if len(digits) != 4 || strings.Trim(digits, "0123456789") != "" {
+			t.Fatalf("generated %q, want 4 digits", digits)
+		}
+		seen[digits[:1]] = true
+	}
+	// Leading zeros are kept, and every digit turns up first in a thousand draws.
+	if len(seen) != 10 {
+		t.Errorf("only %d different first digits in a thousand draws", len(seen))
+	}
+}
+
+func TestCreateAccountRetriesCollisions(t *testing.T) {
+	service := newTestService(t, DefaultConfig())
+	existing := createTestCard(t, service.cards, "4000003972196502", 0)
+	duplicate := Card{Number: existing.Number, PIN: existing.PIN}
+	if err := service.cards.Create(&duplicate); !errors.Is(err, ErrCardNumberTaken) {
+		t.Fatalf("storing a taken number failed with %v, want %v", err, ErrCardNumberTaken)
+	}
+
+	// The next cards created collide with existing ones.
+	collisions := 0
+	err := serviceDB(service).Callback().Create().Before("gorm:create").Register("test:collide", func(tx *gorm.DB) {
+		if collisions > 0 {
+			collisions--
+			tx.AddError(gorm.ErrDuplicatedKey)
+		}
+	})
+	if err != nil {
+		t.Fatalf("cannot register callback: %v", err)
+	}
+
+	collisions = MaxCardNumberAttempts - 1
+	card, pin, err := service.CreateAccount("", "")
+	if err != nil {
+		t.Fatalf("cannot create card after %d collisions: %v", MaxCardNumberAttempts-1, err)
+	}
+	if _, err := service.Authenticate(card.Number, pin); err != nil {
+		t.Errorf("cannot log into the card: %v", err)
+	}
+
+	collisions = MaxCardNumberAttempts
+	if _, _, err := service.CreateAccount("", ""); !errors.Is(err, ErrCardNumberTaken) {
+		t.Errorf("creating a card with every number taken failed with %v, want %v", err, ErrCardNumberTaken)
+	}
+	if collisions != 0 {
+		t.Errorf("gave up with %d collisions left, want after %d attempts", collisions, MaxCardNumberAttempts)
+	}
+}
+
+func TestAuthenticateLocksOutUntilExpiry(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 9, 0, 0, 0, time.UTC)
+	config := DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	service := newTestService(t, config)
+	card := createTestCard(t, service.cards, "4000003972196502", 0)
+
+	for i := 1; i < DefaultMaxFailedPINAttempts; i++ {
+		if _, err := service.Authenticate(card.Number, "0000"); !errors.Is(err, ErrWrongCredentials) {
+			t.Fatalf("wrong PIN %d failed with %v, want %v", i, err, ErrWrongCredentials)
+		}
+	}
+	var blocked *CardBlockedError
+	want := now.Add(DefaultLockoutDuration)
+	if _, err := service.Authenticate(card.Number, "0000"); !errors.As(err, &blocked) || !blocked.Until.Equal(want) {
+		t.Fatalf("last wrong PIN failed with %v, want a lockout until %v", err, want)
+	}
+
+	// The right PIN is refused until the lockout expires by the clock of the service.
+	now = want.Add(-time.Second)
+	if _, err := service.Authenticate(card.Number, testPIN); !errors.As(err, &blocked) {
+		t.Errorf("right PIN during the lockout failed with %v, want a lockout", err)
+	}
+	now = want
+	if _, err := service.Authenticate(card.Number, testPIN); err != nil {
+		t.Fatalf("cannot log in once the lockout expired: %v", err)
+	}
+	if unlocked, _ := service.GetCard(card.Number); unlocked.FailedPINAttempts != 0 || unlocked.LockedUntil != nil {
+		t.Errorf("card keeps %d failed attempts and lockout %v", unlocked.FailedPINAttempts, unlocked.LockedUntil)
+	}
+
+	// The attempts count again from zero.
+	if _, err := service.Authenticate(card.Number, "0000"); !errors.Is(err, ErrWrongCredentials) {
+		t.Errorf("wrong PIN after the lockout failed with %v, want %v", err, ErrWrongCredentials)
+	}
+}
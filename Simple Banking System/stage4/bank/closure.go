@@ -0,0 +1,106 @@
+package bank
+
+import (
+	"fmt"
+	"time"
+)
+
+// CloseRequest describes how an account is closed.
+type CloseRequest struct {
+	Reason string
+	// PayoutCardNumber is the card that receives the remaining balance. It may only be empty
+	// when the balance is zero.
+	PayoutCardNumber string
+}
+
+// Statement is the closing statement of an account.
+type Statement struct {
+	CardNumber string
+	Reason     string
+	OpenedAt   time.Time
+	ClosedAt   time.Time
+	// Entries are all ledger entries of the account of the card, oldest first, including the
+	// payout and the entries made with the cards it replaced.
+	Entries []Transaction
+	Credits Money
+	Debits  Money
+	// Payout is the balance transferred to PayoutCardNumber on closure, if any.
+	Payout           *Money
+	PayoutCardNumber string
+}
+
+// Close closes the account of card. Any remaining balance is first paid out to the card in
+// request, and the card is then marked closed and soft-deleted, keeping its number reserved
+// so that it can be reopened.
+func (s *Service) Close(card *Card, request CloseRequest) (*Statement, error) {
+	current, err := s.GetCard(card.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	var payee *Card
+	if current.Balance != 0 {
+		if request.PayoutCardNumber == "" {
+			return nil, fmt.Errorf("%w: %v left on card %s", ErrBalanceRemaining, current.Money(), current.Number)
+		}
+		if payee, err = s.CheckRecipient(current, request.PayoutCardNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	statement := &Statement{CardNumber: current.Number, Reason: request.Reason, OpenedAt: current.CreatedAt}
+	err = s.cards.Transaction(func(cards CardRepository) error {
+		statement.Payout, statement.PayoutCardNumber = nil, ""
+		if payee != nil {
+			payout := current.Money()
+			if _, _, err := s.moveMoney(cards, s.ledgerEntry(KindPayout), current.Number, payee, payout); err != nil {
+				return err
+			}
+			statement.Payout, statement.PayoutCardNumber = &payout, payee.Number
+		}
+
+		// A deposit that arrived after the payout leaves money on the card, so the closure only
+		// goes through if the balance is still zero.
+		if err := cards.Delete(current.Number, request.Reason); err != nil {
+			return err
+		}
+
+		return statement.summarize(cards, current, s.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	card.setBalance(0)
+	card.Status, card.ClosedReason = StatusClosed, request.Reason
+	return statement, nil
+}
+
+func (st *Statement) summarize(cards CardRepository, card *Card, closedAt time.Time) error {
+	var err error
+	if st.Entries, err = cards.Entries(EntryQuery{AccountID: card.AccountID}); err != nil {
+		return err
+	}
+
+	st.Credits = Money{Currency: card.Currency}
+	st.Debits = Money{Currency: card.Currency}
+	for _, entry := range st.Entries {
+		if entry.Entry == EntryCredit {
+			st.Credits, err = st.Credits.Add(entry.Money())
+		} else {
+			st.Debits, err = st.Debits.Add(entry.Money())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	st.ClosedAt = closedAt
+	return nil
+}
+
+// Reopen restores a closed card with its number, PIN and zero balance. It is an administrative
+// operation: the card holder does not need to authenticate.
+func (s *Service) Reopen(cardNumber string) (*Card, error) {
+	return s.cards.Restore(cardNumber)
+}
@@ -0,0 +1,83 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseWithPayoutAndReopen(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 9, 0, 0, 0, time.UTC)
+	config := DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	service := newTestService(t, config)
+	card, pin, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	payee, _, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	if err := service.Deposit(card, usd(5000)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if err := service.Withdraw(card, usd(1500)); err != nil {
+		t.Fatalf("withdrawal failed: %v", err)
+	}
+
+	if _, err := service.Close(card, CloseRequest{Reason: "unused"}); !errors.Is(err, ErrBalanceRemaining) {
+		t.Errorf("closing without a payout card failed with %v, want %v", err, ErrBalanceRemaining)
+	}
+	if _, err := service.Close(card, CloseRequest{Reason: "unused", PayoutCardNumber: card.Number}); !errors.Is(err, ErrSameAccount) {
+		t.Errorf("paying out to the closed card failed with %v, want %v", err, ErrSameAccount)
+	}
+
+	now = now.Add(time.Hour)
+	statement, err := service.Close(card, CloseRequest{Reason: "unused", PayoutCardNumber: payee.Number})
+	if err != nil {
+		t.Fatalf("cannot close the account: %v", err)
+	}
+	if statement.Payout == nil || *statement.Payout != usd(3500) || statement.PayoutCardNumber != payee.Number {
+		t.Errorf("paid out %v to %s, want 35.00 to %s", statement.Payout, statement.PayoutCardNumber, payee.Number)
+	}
+	if statement.Reason != "unused" || !statement.ClosedAt.Equal(now) {
+		t.Errorf("statement closed at %v for %q, want %v for %q", statement.ClosedAt, statement.Reason, now, "unused")
+	}
+	// The statement balances: 50.00 in, 15.00 withdrawn and 35.00 paid out.
+	if len(statement.Entries) != 3 || statement.Credits.Amount != 5000 || statement.Debits.Amount != 5000 {
+		t.Errorf("statement has %d entries, credits %v and debits %v, want 3 entries of 50.00 each way",
+			len(statement.Entries), statement.Credits, statement.Debits)
+	}
+	if last := statement.Entries[len(statement.Entries)-1]; last.Kind != KindPayout || last.Counterparty != payee.Number {
+		t.Errorf("last entry is %+v, want the payout", last)
+	}
+	if card.Status != StatusClosed || card.Balance != 0 || card.WholeBalance != 0 {
+		t.Errorf("closed card has status %q and balance %d", card.Status, card.Balance)
+	}
+	if balance, _ := service.Balance(payee.Number); balance.Amount != 3500 {
+		t.Errorf("payee holds %v, want 35.00", balance)
+	}
+
+	// The number stays reserved: the card is known to be closed rather than missing.
+	if err := service.Deposit(payee, usd(100)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if err := service.Transfer(payee, card.Number, usd(100)); !errors.Is(err, ErrAccountClosed) {
+		t.Errorf("transfer to the closed card failed with %v, want %v", err, ErrAccountClosed)
+	}
+	if _, err := service.Reopen(payee.Number); !errors.Is(err, ErrAccountNotClosed) {
+		t.Errorf("reopening an open card failed with %v, want %v", err, ErrAccountNotClosed)
+	}
+
+	reopened, err := service.Reopen(card.Number)
+	if err != nil {
+		t.Fatalf("cannot reopen the card: %v", err)
+	}
+	if reopened.Status != StatusActive || reopened.Balance != 0 || reopened.ClosedReason != "" {
+		t.Errorf("reopened card is %+v, want an empty active card", reopened)
+	}
+	if _, err := service.Authenticate(card.Number, pin); err != nil {
+		t.Errorf("cannot log into the reopened card with its PIN: %v", err)
+	}
+}
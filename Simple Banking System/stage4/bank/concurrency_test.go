@@ -0,0 +1,114 @@
+package bank
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+const (
+	stressCards     = 8
+	stressSessions  = 4
+	stressWorkers   = 16
+	stressTransfers = 40
+	stressDeposit   = 1000
+)
+
+// TestConcurrentTransfersConserveMoney runs many transfers in parallel from several sessions on
+// the same storage, as separate tellers would, and checks that no update is lost: the total of
+// all balances stays equal to what was deposited and every balance matches its ledger.
+func TestConcurrentTransfersConserveMoney(t *testing.T) {
+	forEachBackend(t, testConcurrentTransfers)
+}
+
+func testConcurrentTransfers(t *testing.T, session func() CardRepository) {
+	sessions := make([]*Service, stressSessions)
+	for i := range sessions {
+		sessions[i] = NewService(session(), DefaultConfig())
+	}
+
+	cards := make([]*Card, stressCards)
+	for i := range cards {
+		card, _, err := sessions[0].CreateAccount(DefaultCurrency, "")
+		if err != nil {
+			t.Fatalf("cannot create card: %v", err)
+		}
+		if err := sessions[0].Deposit(card, Money{Amount: stressDeposit, Currency: DefaultCurrency}); err != nil {
+			t.Fatalf("cannot deposit: %v", err)
+		}
+		cards[i] = card
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, stressWorkers*stressTransfers)
+	for worker := 0; worker < stressWorkers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			service := sessions[worker%stressSessions]
+			random := rand.New(rand.NewSource(int64(worker)))
+			for i := 0; i < stressTransfers; i++ {
+				from := random.Intn(stressCards)
+				to := (from + 1 + random.Intn(stressCards-1)) % stressCards
+
+				// Every session works on its own copies of the cards, like a logged in user would.
+				sender := &Card{Number: cards[from].Number, Currency: cards[from].Currency}
+				recipient := &Card{Number: cards[to].Number, Currency: cards[to].Currency}
+				amount := Money{Amount: int64(1 + random.Intn(stressDeposit/2)), Currency: DefaultCurrency}
+
+				err := service.ExecuteTransfer(sender, recipient, amount)
+				if err != nil && !errors.Is(err, ErrInsufficientFunds) {
+					errs <- err
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("transfer failed: %v", err)
+	}
+
+	var total int64
+	for _, card := range cards {
+		balance, err := sessions[0].Balance(card.Number)
+		if err != nil {
+			t.Fatalf("cannot read balance: %v", err)
+		}
+		if balance.Amount < 0 {
+			t.Errorf("card %s is overdrawn: %v", card.Number, balance)
+		}
+		total += balance.Amount
+
+		entries, err := sessions[0].cards.Entries(EntryQuery{CardNumber: card.Number})
+		if err != nil {
+			t.Fatalf("cannot load ledger: %v", err)
+		}
+		var credits, debits int64
+		for _, entry := range entries {
+			if entry.Entry == EntryCredit {
+				credits += entry.Amount
+			} else {
+				debits += entry.Amount
+			}
+		}
+		if credits-debits != balance.Amount {
+			t.Errorf("card %s has balance %d but its ledger sums to %d", card.Number, balance.Amount, credits-debits)
+		}
+
+		stored, err := sessions[0].cards.FindByNumber(card.Number)
+		if err != nil {
+			t.Fatalf("cannot load card: %v", err)
+		}
+		if stored.WholeBalance != balance.WholeUnits() {
+			t.Errorf("card %s has %d whole units in the balance column, want %d", card.Number, stored.WholeBalance, balance.WholeUnits())
+		}
+	}
+
+	if want := int64(stressCards * stressDeposit); total != want {
+		t.Errorf("total balance is %d, want %d", total, want)
+	}
+}
@@ -0,0 +1,108 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// Failures of the customer operations
+var (
+	ErrCustomerNotFound   = errors.New("customer not found")
+	ErrCustomerRegistered = errors.New("card already belongs to a customer")
+	ErrCustomerName       = errors.New("customer name is required")
+	ErrNotOwnCard         = errors.New("card belongs to another customer")
+)
+
+// Customer is the holder of one or more cards. Cards issued before customers were recorded have
+// none until their holder registers.
+type Customer struct {
+	gorm.Model
+	Name  string `gorm:"not null"`
+	Email string
+	Phone string
+	Cards []Card
+}
+
+// RegisterCustomer records customer as the holder of card, which must not have one yet, and
+// returns it with its ID filled in.
+func (s *Service) RegisterCustomer(card *Card, customer Customer) (*Customer, error) {
+	customer.Name = strings.TrimSpace(customer.Name)
+	customer.Email = strings.TrimSpace(customer.Email)
+	customer.Phone = strings.TrimSpace(customer.Phone)
+	if customer.Name == "" {
+		return nil, ErrCustomerName
+	}
+	customer.Cards = nil
+
+	var updated *Card
+	err := s.cards.Transaction(func(cards CardRepository) error {
+		current, err := findOpenCard(cards, card.Number)
+		if err != nil {
+			return err
+		}
+		if current.CustomerID != nil {
+			return ErrCustomerRegistered
+		}
+
+		if err := cards.CreateCustomer(&customer); err != nil {
+			return fmt.Errorf("cannot create customer: %w", err)
+		}
+		updated, err = cards.SetCustomer(card.Number, customer.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	*card = *updated
+	return &customer, nil
+}
+
+// Customer returns the holder of card with their open cards, or ErrCustomerNotFound if the card
+// has none.
+func (s *Service) Customer(card *Card) (*Customer, error) {
+	current, err := findOpenCard(s.cards, card.Number)
+	if err != nil {
+		return nil, err
+	}
+	if current.CustomerID == nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	customer, err := s.cards.FindCustomer(*current.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.Cards, err = s.cards.CustomerCards(customer.ID); err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// OpenAdditionalCard issues a new card for the holder of card, like CreateAccount does for a new
+// holder. The holder must have registered with RegisterCustomer.
+func (s *Service) OpenAdditionalCard(card *Card, currency, product string) (*Card, string, error) {
+	customer, err := s.Customer(card)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.createCard(currency, product, &customer.ID)
+}
+
+// TransferToOwnCard transfers amount from sender to another card of the same customer.
+func (s *Service) TransferToOwnCard(sender *Card, recipientCardNumber string, amount Money) error {
+	recipient, err := s.CheckRecipient(sender, recipientCardNumber)
+	if err != nil {
+		return err
+	}
+	current, err := findOpenCard(s.cards, sender.Number)
+	if err != nil {
+		return err
+	}
+	if current.CustomerID == nil || recipient.CustomerID == nil || *current.CustomerID != *recipient.CustomerID {
+		return ErrNotOwnCard
+	}
+	return s.Transfer(sender, recipientCardNumber, amount)
+}
@@ -0,0 +1,79 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCustomerOwnsAdditionalCards(t *testing.T) {
+	service := NewService(NewMemoryCardRepository(), DefaultConfig())
+	first, _, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+
+	if _, _, err := service.OpenAdditionalCard(first, DefaultCurrency, ""); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("opening a card before registering failed with %v, want %v", err, ErrCustomerNotFound)
+	}
+	if _, err := service.RegisterCustomer(first, Customer{Name: "  "}); !errors.Is(err, ErrCustomerName) {
+		t.Errorf("registering without a name failed with %v, want %v", err, ErrCustomerName)
+	}
+
+	customer, err := service.RegisterCustomer(first, Customer{Name: " Ada Lovelace ", Phone: "+44 20 7946 0000"})
+	if err != nil {
+		t.Fatalf("cannot register customer: %v", err)
+	}
+	if customer.Name != "Ada Lovelace" || first.CustomerID == nil || *first.CustomerID != customer.ID {
+		t.Errorf("registered %+v, card belongs to %v", customer, first.CustomerID)
+	}
+	if _, err := service.RegisterCustomer(first, Customer{Name: "Charles Babbage"}); !errors.Is(err, ErrCustomerRegistered) {
+		t.Errorf("registering again failed with %v, want %v", err, ErrCustomerRegistered)
+	}
+
+	second, _, err := service.OpenAdditionalCard(first, DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot open additional card: %v", err)
+	}
+	if second.CustomerID == nil || *second.CustomerID != customer.ID {
+		t.Errorf("additional card belongs to %v, want %d", second.CustomerID, customer.ID)
+	}
+
+	found, err := service.Customer(second)
+	if err != nil {
+		t.Fatalf("cannot load customer: %v", err)
+	}
+	if found.ID != customer.ID || len(found.Cards) != 2 || found.Cards[0].Number != first.Number || found.Cards[1].Number != second.Number {
+		t.Errorf("customer is %+v, want both cards", found)
+	}
+}
+
+func TestTransferToOwnCard(t *testing.T) {
+	service := NewService(NewMemoryCardRepository(), DefaultConfig())
+	first, _, _ := service.CreateAccount(DefaultCurrency, "")
+	if _, err := service.RegisterCustomer(first, Customer{Name: "Ada Lovelace"}); err != nil {
+		t.Fatalf("cannot register customer: %v", err)
+	}
+	second, _, _ := service.OpenAdditionalCard(first, DefaultCurrency, "")
+	stranger, _, _ := service.CreateAccount(DefaultCurrency, "")
+
+	if err := service.Deposit(first, Money{Amount: 1000, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if err := service.TransferToOwnCard(first, second.Number, Money{Amount: 400, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("transfer to own card failed: %v", err)
+	}
+	if first.Balance != 600 {
+		t.Errorf("sender has %d after the transfer, want 600", first.Balance)
+	}
+	if balance, _ := service.Balance(second.Number); balance.Amount != 400 {
+		t.Errorf("own card has %v after the transfer, want 4.00", balance)
+	}
+
+	err := service.TransferToOwnCard(first, stranger.Number, Money{Amount: 100, Currency: DefaultCurrency})
+	if !errors.Is(err, ErrNotOwnCard) {
+		t.Errorf("transfer to another customer's card failed with %v, want %v", err, ErrNotOwnCard)
+	}
+	if err := service.TransferToOwnCard(stranger, first.Number, Money{Amount: 1, Currency: DefaultCurrency}); !errors.Is(err, ErrNotOwnCard) {
+		t.Errorf("transfer from a card without customer failed with %v, want %v", err, ErrNotOwnCard)
+	}
+}
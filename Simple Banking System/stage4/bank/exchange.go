@@ -0,0 +1,196 @@
+package bank
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoExchangeRate is returned when a transfer needs a conversion that no rate is known for.
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// ExchangeRateProvider supplies the rates used to convert transfers between currencies.
+type ExchangeRateProvider interface {
+	// Rate returns how many units of currency to one unit of currency from is worth.
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// RatesTable is an ExchangeRateProvider backed by a fixed table of rates.
+type RatesTable struct {
+	rates map[[2]string]*big.Rat
+}
+
+// ratesFile is the JSON layout of a rates table: the value of one unit of Base in each currency.
+type ratesFile struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+// LoadRatesTable reads a rates table from a local file. A ".json" file holds the rates of
+// every currency against a base currency:
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "JPY": "149.50"}}
+//
+// Any other file is read as CSV with one "from,to,rate" row per currency pair, optionally
+// preceded by that header. Rates are decimal strings so they are kept exactly, and the inverse
+// of every listed pair is implied.
+func LoadRatesTable(path string) (*RatesTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table := &RatesTable{rates: map[[2]string]*big.Rat{}}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = table.readJSON(file)
+	} else {
+		err = table.readCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rates from %s: %v", path, err)
+	}
+	return table, nil
+}
+
+func (t *RatesTable) readJSON(r io.Reader) error {
+	var file ratesFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return err
+	}
+
+	base := map[string]*big.Rat{file.Base: big.NewRat(1, 1)}
+	for currency, value := range file.Rates {
+		rate, err := parsePositiveDecimal(value)
+		if err != nil {
+			return err
+		}
+		base[currency] = rate
+	}
+
+	for from, fromRate := range base {
+		for to, toRate := range base {
+			if err := t.Set(from, to, new(big.Rat).Quo(toRate, fromRate)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *RatesTable) readCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[2], "rate") {
+			continue // header row
+		}
+
+		rate, err := parsePositiveDecimal(record[2])
+		if err != nil {
+			return err
+		}
+		if err := t.Set(record[0], record[1], rate); err != nil {
+			return err
+		}
+		if err := t.Set(record[1], record[0], new(big.Rat).Inv(rate)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parsePositiveDecimal(value string) (*big.Rat, error) {
+	decimal, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || decimal.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid positive decimal %q", value)
+	}
+	return decimal, nil
+}
+
+// Set records the rate for converting currency from to currency to.
+func (t *RatesTable) Set(from, to string, rate *big.Rat) error {
+	for _, currency := range []string{from, to} {
+		if _, err := CurrencyExponent(currency); err != nil {
+			return err
+		}
+	}
+	t.rates[[2]string{from, to}] = rate
+	return nil
+}
+
+func (t *RatesTable) Rate(from, to string) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	rate, ok := t.rates[[2]string{from, to}]
+	if !ok {
+		return nil, fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, from, to)
+	}
+	return new(big.Rat).Set(rate), nil
+}
+
+// Convert converts amount into currency at rate, rounding to the nearest minor unit of currency
+// with ties to even.
+func Convert(amount Money, currency string, rate *big.Rat) (Money, error) {
+	fromExponent, err := CurrencyExponent(amount.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	toExponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	value := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Amount), rate)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toExponent-fromExponent))), nil)
+	if toExponent > fromExponent {
+		value.Mul(value, new(big.Rat).SetInt(scale))
+	} else {
+		value.Quo(value, new(big.Rat).SetInt(scale))
+	}
+
+	converted := roundHalfEven(value)
+	if !converted.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %v in %s", ErrAmountOverflow, amount, currency)
+	}
+	return Money{Amount: converted.Int64(), Currency: currency}, nil
+}
+
+// roundHalfEven rounds r to the nearest integer, rounding ties to the even neighbour.
+func roundHalfEven(r *big.Rat) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+
+	twiceRemainder := new(big.Int).Abs(remainder)
+	twiceRemainder.Lsh(twiceRemainder, 1)
+	switch twiceRemainder.Cmp(r.Denom()) {
+	case 1:
+		quotient.Add(quotient, big.NewInt(int64(r.Sign())))
+	case 0:
+		if quotient.Bit(0) == 1 {
+			quotient.Add(quotient, big.NewInt(int64(r.Sign())))
+		}
+	}
+	return quotient
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
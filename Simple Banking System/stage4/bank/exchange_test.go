@@ -0,0 +1,139 @@
+package bank
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertRoundsHalfToEven(t *testing.T) {
+	for _, test := range []struct {
+		amount   Money
+		currency string
+		rate     string
+		want     int64
+	}{
+		// 1.00 USD at 0.925 is 92.5 cents, a tie rounded down to the even 92.
+		{Money{Amount: 100, Currency: "USD"}, "EUR", "0.925", 92},
+		// 3.00 USD is 277.5 cents, a tie rounded up to the even 278.
+		{Money{Amount: 300, Currency: "USD"}, "EUR", "0.925", 278},
+		{Money{Amount: 101, Currency: "USD"}, "EUR", "0.925", 93},
+		{Money{Amount: -100, Currency: "USD"}, "EUR", "0.925", -92},
+		{Money{Amount: -300, Currency: "USD"}, "EUR", "0.925", -278},
+		// Currencies with fewer minor units are rounded to them: 1.00 USD is 149.5 JPY.
+		{Money{Amount: 100, Currency: "USD"}, "JPY", "149.5", 150},
+		{Money{Amount: 300, Currency: "USD"}, "JPY", "149.5", 448},
+		{Money{Amount: 1, Currency: "USD"}, "JPY", "149.5", 1},
+		// and those with more are not: 1.00 USD is 0.3075 KWD, 307.5 fils.
+		{Money{Amount: 100, Currency: "USD"}, "KWD", "0.3075", 308},
+		{Money{Amount: 150, Currency: "JPY"}, "USD", "0.0066", 99},
+	} {
+		rate, _ := new(big.Rat).SetString(test.rate)
+		converted, err := Convert(test.amount, test.currency, rate)
+		if err != nil || converted != (Money{Amount: test.want, Currency: test.currency}) {
+			t.Errorf("%v at %s is %v, %v, want %d %s", test.amount, test.rate, converted, err, test.want, test.currency)
+		}
+	}
+
+	if _, err := Convert(Money{Amount: math.MaxInt64, Currency: "USD"}, "EUR", big.NewRat(2, 1)); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("converting a huge amount failed with %v, want %v", err, ErrAmountOverflow)
+	}
+	if _, err := Convert(Money{Amount: 1, Currency: "USD"}, "XXX", big.NewRat(1, 1)); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("converting to an unknown currency failed with %v, want %v", err, ErrUnknownCurrency)
+	}
+}
+
+func TestLoadRatesTable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rates.json": `{"base": "USD", "rates": {"EUR": "0.8", "JPY": "150"}}`,
+		"rates.csv":  "from,to,rate\n# Hand-kept rates\nUSD,EUR,0.8\nUSD,JPY,150\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("cannot write %s: %v", name, err)
+		}
+		table, err := LoadRatesTable(path)
+		if err != nil {
+			t.Fatalf("cannot load %s: %v", name, err)
+		}
+
+		for _, test := range []struct {
+			from, to, want string
+		}{
+			{"USD", "EUR", "4/5"},
+			{"EUR", "USD", "5/4"},
+			{"JPY", "USD", "1/150"},
+		} {
+			if rate, err := table.Rate(test.from, test.to); err != nil || rate.RatString() != test.want {
+				t.Errorf("%s: rate from %s to %s is %v, %v, want %s", name, test.from, test.to, rate, err, test.want)
+			}
+		}
+		if _, err := table.Rate("USD", "GBP"); !errors.Is(err, ErrNoExchangeRate) {
+			t.Errorf("%s: missing rate failed with %v, want %v", name, err, ErrNoExchangeRate)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"negative.csv": "USD,EUR,-0.8\n",
+		"unknown.csv":  "USD,XXX,0.8\n",
+		"fraction.csv": "USD,EUR,4/5x\n",
+		"broken.json":  `{"base": "USD", "rates": {"EUR": 0.8}}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("cannot write %s: %v", name, err)
+		}
+		if _, err := LoadRatesTable(path); err == nil {
+			t.Errorf("loading %s succeeded, want an error", name)
+		}
+	}
+}
+
+func TestCrossCurrencyTransferRecordsRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	if err := os.WriteFile(path, []byte("USD,JPY,149.5\n"), 0o644); err != nil {
+		t.Fatalf("cannot write rates: %v", err)
+	}
+	rates, err := LoadRatesTable(path)
+	if err != nil {
+		t.Fatalf("cannot load rates: %v", err)
+	}
+	config := DefaultConfig()
+	config.ExchangeRates = rates
+	service := newTestService(t, config)
+
+	sender, _, err := service.CreateAccount("USD", "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	recipient, _, err := service.CreateAccount("JPY", "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	if err := service.Deposit(sender, Money{Amount: 1000, Currency: "USD"}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	withoutRates := NewService(service.cards, DefaultConfig())
+	if err := withoutRates.Transfer(sender, recipient.Number, Money{Amount: 300, Currency: "USD"}); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("transfer without rates failed with %v, want %v", err, ErrNoExchangeRate)
+	}
+
+	if err := service.Transfer(sender, recipient.Number, Money{Amount: 300, Currency: "USD"}); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	if card, _ := service.GetCard(recipient.Number); card.Money() != (Money{Amount: 448, Currency: "JPY"}) || card.WholeBalance != 448 {
+		t.Errorf("recipient holds %v and %d whole units, want 448 JPY", card.Money(), card.WholeBalance)
+	}
+	if card, _ := service.GetCard(sender.Number); card.Money() != (Money{Amount: 700, Currency: "USD"}) || card.WholeBalance != 7 {
+		t.Errorf("sender holds %v and %d whole units, want 7.00 USD", card.Money(), card.WholeBalance)
+	}
+	history, _ := service.History(recipient.Number, 1)
+	if len(history) != 1 || history[0].Rate != "149.5" || history[0].Amount != 448 {
+		t.Errorf("recipient ledger is %+v, want 448 JPY credited at 149.5", history)
+	}
+}
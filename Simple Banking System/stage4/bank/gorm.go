@@ -0,0 +1,466 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// GormCardRepository is a CardRepository backed by a SQL database through GORM. It runs on
+// SQLite and PostgreSQL.
+type GormCardRepository struct {
+	db *gorm.DB
+	// MaxBusyRetries is how many times a transaction is run again after SQLite reported the
+	// database locked by another session.
+	MaxBusyRetries int
+	// inTransaction is set on the repository given to a transaction, whose db is the transaction.
+	inTransaction bool
+}
+
+// NewGormCardRepository applies the pending migrations to db and returns a repository using it.
+// It fails with SchemaTooNewError if db was migrated by a newer program. The database should be
+// opened with TranslateError so that card number collisions are detected.
+func NewGormCardRepository(db *gorm.DB) (*GormCardRepository, error) {
+	if err := MigrateUp(db); err != nil {
+		return nil, err
+	}
+	return &GormCardRepository{db: db, MaxBusyRetries: DefaultMaxBusyRetries}, nil
+}
+
+// OpenDatabase opens the SQL database described by dsn, which is either sqlite:<path> or a
+// postgres:// URL, without touching its schema. The PostgreSQL backend is experimental, see
+// OpenRepository.
+func OpenDatabase(dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch {
+	case strings.HasPrefix(dsn, "sqlite:"):
+		dialector = sqlite.Open(SQLiteDSN(strings.TrimPrefix(dsn, "sqlite:")))
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		dialector = postgres.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database %q: expected sqlite:<path> or postgres://", dsn)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true, NowFunc: utcNow})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", dsn, err)
+	}
+	return db, nil
+}
+
+// utcNow is the clock of the databases. Times are stored and compared in UTC, since SQLite keeps
+// them as text, which only sorts in the order of the times in a single time zone.
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+func (r *GormCardRepository) Transaction(fn func(cards CardRepository) error) error {
+	if r.inTransaction {
+		return fn(r)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			return fn(&GormCardRepository{db: tx, inTransaction: true})
+		})
+		if err == nil || !isBusy(err) || attempt >= r.MaxBusyRetries {
+			return err
+		}
+		delay := time.Duration(attempt+1) * BusyRetryDelay
+		time.Sleep(delay/2 + time.Duration(rand.Int63n(int64(delay))))
+	}
+}
+
+// withBalance returns a query of the cards together with the balance of their account.
+func (r *GormCardRepository) withBalance() *gorm.DB {
+	return r.db.Model(&Card{}).
+		Select(TableName + ".*, " + AccountsTableName + ".balance AS account_balance").
+		Joins("JOIN " + AccountsTableName + " ON " + AccountsTableName + ".id = " + TableName + ".account_id")
+}
+
+func (r *GormCardRepository) FindByNumber(number string) (*Card, error) {
+	var card Card
+	result := r.withBalance().Unscoped().Where("number = ?", number).Limit(1).Find(&card)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCardNotFound
+	}
+	return &card, nil
+}
+
+func (r *GormCardRepository) Create(card *Card) error {
+	accountID := card.AccountID
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if card.AccountID == 0 {
+			account := Account{Currency: card.Currency}
+			if err := tx.Create(&account).Error; err != nil {
+				return fmt.Errorf("cannot create account: %w", err)
+			}
+			card.AccountID = account.ID
+		}
+		return tx.Create(card).Error
+	})
+	if err != nil {
+		card.AccountID = accountID
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %s", ErrCardNumberTaken, card.Number)
+	}
+	return err
+}
+
+func (r *GormCardRepository) UpdateBalance(number string, delta Money) (*Card, error) {
+	if delta.Amount == math.MinInt64 {
+		return nil, fmt.Errorf("%w: balance of card %s", ErrAmountOverflow, number)
+	}
+
+	card, err := findOpenCard(r, number)
+	if err != nil {
+		return nil, err
+	}
+	if card.Currency != delta.Currency {
+		return nil, fmt.Errorf("%w: %s on a %s card", ErrCurrencyMismatch, delta.Currency, card.Currency)
+	}
+	unit, err := currencyUnit(card.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated bool
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		// The conditions make the database refuse an update that would leave the balance negative
+		// or overflow it, so concurrent updates cannot go around the checks.
+		query := tx.Model(&Account{}).Where("id = ? AND currency = ?", card.AccountID, delta.Currency)
+		if delta.Amount < 0 {
+			query = query.Where("balance >= ?", -delta.Amount)
+		} else {
+			query = query.Where("balance <= ?", math.MaxInt64-delta.Amount)
+		}
+		result := query.Update("balance", gorm.Expr("balance + ?", delta.Amount))
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		updated = true
+
+		// The whole-unit balance of the cards follows the account, from the balance just written.
+		return tx.Unscoped().Model(&Card{}).
+			Where("account_id = ?", card.AccountID).
+			Update("balance", gorm.Expr("(SELECT balance FROM "+AccountsTableName+" WHERE id = ?) / ?", card.AccountID, unit)).
+			Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot update balance of card %s: %w", number, err)
+	}
+
+	if card, err = findOpenCard(r, number); err != nil {
+		return nil, err
+	}
+	if updated {
+		return card, nil
+	}
+
+	if delta.Amount < 0 {
+		return nil, &InsufficientFundsError{
+			CardNumber: number,
+			Balance:    card.Money(),
+			Amount:     Money{Amount: -delta.Amount, Currency: delta.Currency},
+		}
+	}
+	return nil, fmt.Errorf("%w: balance of card %s", ErrAmountOverflow, number)
+}
+
+func (r *GormCardRepository) Transfer(from, to string, debit, credit Money) (*Card, *Card, error) {
+	return transferBalances(r, from, to, debit, credit)
+}
+
+func (r *GormCardRepository) Delete(number, reason string) error {
+	result := r.db.Model(&Card{}).
+		Where("number = ?", number).
+		Where("EXISTS (SELECT 1 FROM " + AccountsTableName + " WHERE " + AccountsTableName + ".id = " +
+			TableName + ".account_id AND " + AccountsTableName + ".balance = 0)").
+		Updates(map[string]any{"status": StatusClosed, "closed_reason": reason, "deleted_at": utcNow()})
+	if result.Error != nil {
+		return fmt.Errorf("cannot close card %s: %w", number, result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	card, err := findOpenCard(r, number)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %v left on card %s", ErrBalanceRemaining, card.Money(), number)
+}
+
+func (r *GormCardRepository) Restore(number string) (*Card, error) {
+	card, err := r.FindByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	if !card.DeletedAt.Valid || card.Status != StatusClosed {
+		return nil, ErrAccountNotClosed
+	}
+
+	result := r.db.Unscoped().Model(card).
+		Updates(map[string]any{"deleted_at": nil, "status": StatusActive, "closed_reason": ""})
+	if result.Error != nil {
+		return nil, fmt.Errorf("cannot reopen card %s: %w", number, result.Error)
+	}
+
+	card.DeletedAt, card.Status, card.ClosedReason = gorm.DeletedAt{}, StatusActive, ""
+	return card, nil
+}
+
+func (r *GormCardRepository) Deactivate(number, status string) error {
+	result := r.db.Model(&Card{}).
+		Where("number = ?", number).
+		Updates(map[string]any{"status": status, "deleted_at": utcNow()})
+	if result.Error != nil {
+		return fmt.Errorf("cannot deactivate card %s: %w", number, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		_, err := findOpenCard(r, number)
+		return err
+	}
+	return nil
+}
+
+func (r *GormCardRepository) SetLockout(number string, failedPINAttempts int, lockedUntil *time.Time) error {
+	result := r.db.Unscoped().Model(&Card{}).
+		Where("number = ?", number).
+		Updates(map[string]any{"failed_pin_attempts": failedPINAttempts, "locked_until": lockedUntil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCardNotFound
+	}
+	return nil
+}
+
+func (r *GormCardRepository) SetWithdrawalLimits(number string, perWithdrawal, daily *int64) error {
+	result := r.db.Model(&Card{}).
+		Where("number = ?", number).
+		Updates(map[string]any{"withdrawal_limit": perWithdrawal, "daily_withdrawal_limit": daily})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		_, err := findOpenCard(r, number)
+		return err
+	}
+	return nil
+}
+
+func (r *GormCardRepository) SetInterestRate(number string, rate *InterestRate) error {
+	result := r.db.Model(&Card{}).Where("number = ?", number).Update("interest_rate", rate)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		_, err := findOpenCard(r, number)
+		return err
+	}
+	return nil
+}
+
+func (r *GormCardRepository) FindAccount(id uint) (*Account, error) {
+	var account Account
+	result := r.db.Where("id = ?", id).Limit(1).Find(&account)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAccountNotFound
+	}
+	return &account, nil
+}
+
+func (r *GormCardRepository) InterestDueCards(until time.Time) ([]Card, error) {
+	var cards []Card
+	result := r.withBalance().
+		Where(AccountsTableName+".interest_accrued_until IS NULL OR "+AccountsTableName+".interest_accrued_until < ?", until.UTC()).
+		Order(TableName + ".account_id").
+		Find(&cards)
+	return cards, result.Error
+}
+
+func (r *GormCardRepository) UpdateInterest(from, to *Account) error {
+	query := r.db.Model(&Account{}).Where("id = ?", from.ID)
+	if from.InterestAccruedUntil == nil {
+		query = query.Where("interest_accrued_until IS NULL")
+	} else {
+		query = query.Where("interest_accrued_until = ?", from.InterestAccruedUntil.UTC())
+	}
+	var accruedUntil *time.Time
+	if to.InterestAccruedUntil != nil {
+		until := to.InterestAccruedUntil.UTC()
+		accruedUntil = &until
+	}
+	result := query.Updates(map[string]any{
+		"accrued_interest":       to.AccruedInterest,
+		"interest_accrued_until": accruedUntil,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("cannot update interest of account %d: %w", from.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := r.FindAccount(from.ID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: account %d", ErrInterestChanged, from.ID)
+	}
+	return nil
+}
+
+func (r *GormCardRepository) CreateCustomer(customer *Customer) error {
+	return r.db.Omit("Cards").Create(customer).Error
+}
+
+func (r *GormCardRepository) FindCustomer(id uint) (*Customer, error) {
+	var customer Customer
+	result := r.db.Where("id = ?", id).Limit(1).Find(&customer)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCustomerNotFound
+	}
+	return &customer, nil
+}
+
+func (r *GormCardRepository) SetCustomer(number string, customerID uint) (*Card, error) {
+	if _, err := r.FindCustomer(customerID); err != nil {
+		return nil, err
+	}
+
+	result := r.db.Model(&Card{}).Where("number = ?", number).Update("customer_id", customerID)
+	if result.Error != nil {
+		return nil, fmt.Errorf("cannot set customer of card %s: %w", number, result.Error)
+	}
+	return findOpenCard(r, number)
+}
+
+func (r *GormCardRepository) CustomerCards(customerID uint) ([]Card, error) {
+	var cards []Card
+	result := r.withBalance().Where("customer_id = ?", customerID).Order(TableName + ".id").Find(&cards)
+	return cards, result.Error
+}
+
+func (r *GormCardRepository) CreateScheduledTransfer(transfer *ScheduledTransfer) error {
+	return r.db.Create(transfer).Error
+}
+
+func (r *GormCardRepository) FindScheduledTransfer(id uint) (*ScheduledTransfer, error) {
+	var transfer ScheduledTransfer
+	result := r.db.Where("id = ?", id).Limit(1).Find(&transfer)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrScheduledTransferNotFound
+	}
+	return &transfer, nil
+}
+
+func (r *GormCardRepository) ScheduledTransfers(senderNumber string) ([]ScheduledTransfer, error) {
+	var transfers []ScheduledTransfer
+	result := r.db.Where("sender_number = ? AND status = ?", senderNumber, ScheduledActive).Order("id").Find(&transfers)
+	return transfers, result.Error
+}
+
+func (r *GormCardRepository) DueScheduledTransfers(now time.Time) ([]ScheduledTransfer, error) {
+	var transfers []ScheduledTransfer
+	result := r.db.Where("status = ? AND next_run_at <= ?", ScheduledActive, now.UTC()).Order("next_run_at, id").Find(&transfers)
+	return transfers, result.Error
+}
+
+func (r *GormCardRepository) UpdateScheduledTransfer(from, to *ScheduledTransfer) error {
+	result := r.db.Model(&ScheduledTransfer{}).
+		Where("id = ? AND status = ? AND occurrence = ? AND attempts = ?", from.ID, from.Status, from.Occurrence, from.Attempts).
+		Updates(map[string]any{
+			"sender_number":    to.SenderNumber,
+			"recipient_number": to.RecipientNumber,
+			"occurrence":       to.Occurrence,
+			"next_run_at":      to.NextRunAt.UTC(),
+			"attempts":         to.Attempts,
+			"status":           to.Status,
+			"last_run_at":      to.LastRunAt,
+			"last_error":       to.LastError,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("cannot update scheduled transfer %d: %w", from.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := r.FindScheduledTransfer(from.ID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %d", ErrScheduleChanged, from.ID)
+	}
+	return nil
+}
+
+func (r *GormCardRepository) MoveScheduledTransfers(from, to string) error {
+	for _, column := range []string{"sender_number", "recipient_number"} {
+		result := r.db.Model(&ScheduledTransfer{}).
+			Where(column+" = ? AND status = ?", from, ScheduledActive).
+			Update(column, to)
+		if result.Error != nil {
+			return fmt.Errorf("cannot move scheduled transfers of card %s: %w", from, result.Error)
+		}
+	}
+	return nil
+}
+
+func (r *GormCardRepository) AddEntries(entries []Transaction) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	for i := range entries {
+		entries[i].CreatedAt = entries[i].CreatedAt.UTC()
+	}
+	return r.db.Create(&entries).Error
+}
+
+func (r *GormCardRepository) Entries(query EntryQuery) ([]Transaction, error) {
+	db := r.db
+	if query.CardNumber != "" {
+		db = db.Where("card_number = ?", query.CardNumber)
+	}
+	if query.Kind != "" {
+		db = db.Where("kind = ?", query.Kind)
+	}
+	if query.Entry != "" {
+		db = db.Where("entry = ?", query.Entry)
+	}
+	if query.AccountID != 0 {
+		db = db.Where("account_id = ?", query.AccountID)
+	}
+	if !query.Since.IsZero() {
+		db = db.Where("created_at > ?", query.Since.UTC())
+	}
+	if !query.Until.IsZero() {
+		db = db.Where("created_at < ?", query.Until.UTC())
+	}
+	if query.NewestFirst {
+		db = db.Order("id DESC")
+	} else {
+		db = db.Order("id")
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+
+	var entries []Transaction
+	result := db.Find(&entries)
+	return entries, result.Error
+}
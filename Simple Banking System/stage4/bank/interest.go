@@ -0,0 +1,260 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Interest accrues daily and is capitalized monthly, by the following rules:
+//
+//   - Rates are nominal annual rates in basis points: 150 is 1.50% a year. A card uses its own
+//     rate if set, the rate of its product otherwise.
+//   - Days are calendar days in UTC, and a day accrues once it has ended. An account that never
+//     accrued interest starts with the day before the first run of AccrueInterest, or the day it
+//     was opened if that is later.
+//   - Every day accrues balance × rate / 365 (Actual/365 Fixed, so a leap year earns 366/365 of
+//     the rate), in millionths of a minor unit of the currency, rounded toward zero. The balance
+//     is the one at the end of the day, replayed from the ledger.
+//   - After the last day of a month, the whole minor units accrued are credited to the account as
+//     a KindInterest ledger entry dated the first instant of the next month, even when
+//     AccrueInterest catches up on it later. The fraction of a minor unit left is carried into the
+//     next month, so the interest credited never falls behind the interest accrued by a minor
+//     unit or more.
+const (
+	// InterestScale is the number of units of accrued interest in a minor unit of currency.
+	InterestScale = 1_000_000
+	// DaysPerYear is the day count the annual rates are divided by.
+	DaysPerYear = 365
+	// MaxInterestRate is the highest rate, 100% a year.
+	MaxInterestRate InterestRate = 100_00
+)
+
+// Failures of the interest accrual
+var (
+	ErrInvalidInterestRate = errors.New("invalid interest rate")
+	ErrInterestChanged     = errors.New("interest accrued meanwhile")
+)
+
+// InterestRate is a nominal annual interest rate in basis points, hundredths of a percent.
+type InterestRate int
+
+// ParseInterestRate parses a rate given as a percentage with at most two decimals, such as "1.5"
+// or "1.50%".
+func ParseInterestRate(s string) (InterestRate, error) {
+	percent, ok := new(big.Rat).SetString(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if !ok {
+		return 0, fmt.Errorf("%w: %q is not a percentage", ErrInvalidInterestRate, s)
+	}
+	basisPoints := percent.Mul(percent, big.NewRat(100, 1))
+	if !basisPoints.IsInt() || !basisPoints.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %q has more than two decimals", ErrInvalidInterestRate, s)
+	}
+	rate := InterestRate(basisPoints.Num().Int64())
+	if err := rate.check(); err != nil {
+		return 0, err
+	}
+	return rate, nil
+}
+
+func (r InterestRate) check() error {
+	if r < 0 || r > MaxInterestRate {
+		return fmt.Errorf("%w: %v is not between 0%% and %v", ErrInvalidInterestRate, r, MaxInterestRate)
+	}
+	return nil
+}
+
+// String formats the rate as a percentage, e.g. "1.50%".
+func (r InterestRate) String() string {
+	sign := ""
+	if r < 0 {
+		sign, r = "-", -r
+	}
+	return fmt.Sprintf("%s%d.%02d%%", sign, r/100, r%100)
+}
+
+// dailyInterest returns the interest balance earns in a day at rate, in 1/InterestScale of a
+// minor unit, rounded toward zero.
+func dailyInterest(balance int64, rate InterestRate) (int64, error) {
+	interest := new(big.Int).Mul(big.NewInt(balance), big.NewInt(int64(rate)*InterestScale))
+	interest.Quo(interest, big.NewInt(100_00*DaysPerYear))
+	if !interest.IsInt64() {
+		return 0, ErrAmountOverflow
+	}
+	return interest.Int64(), nil
+}
+
+// InterestRate returns the rate card earns: its own rate if set, the rate of its product
+// otherwise.
+func (s *Service) InterestRate(card *Card) (InterestRate, error) {
+	if card.InterestRate != nil {
+		return *card.InterestRate, nil
+	}
+	profile, err := s.IssuerProfiles().Find(card.Product)
+	if err != nil {
+		return 0, err
+	}
+	return profile.InterestRate, nil
+}
+
+// SetInterestRate sets the interest rate of card. A nil rate makes the card earn the rate of its
+// product. The new rate applies from the first day that has not accrued yet.
+func (s *Service) SetInterestRate(card *Card, rate *InterestRate) error {
+	if rate != nil {
+		if err := rate.check(); err != nil {
+			return err
+		}
+	}
+	if err := s.cards.SetInterestRate(card.Number, rate); err != nil {
+		return err
+	}
+
+	card.InterestRate = rate
+	return nil
+}
+
+// InterestPosting is interest credited to a card when it was capitalized.
+type InterestPosting struct {
+	CardNumber string
+	// Month is the first day of the month the interest was earned in.
+	Month    time.Time
+	Interest Money
+	Rate     InterestRate
+}
+
+// InterestFailure is a card whose interest could not be accrued. Its days are left for a later
+// run, so they are accrued once the cause is fixed.
+type InterestFailure struct {
+	CardNumber string
+	Err        error
+}
+
+// AccrueInterest accrues the interest of every open card for the days that ended by the clock of
+// the Service and were not accrued yet, and capitalizes it at the end of each month, following
+// the rules above. It returns the interest credited, and the cards it failed on without stopping
+// at them. It is meant to run daily, but catches up on the days it missed; concurrent runs do
+// not accrue a day twice.
+func (s *Service) AccrueInterest() ([]InterestPosting, []InterestFailure, error) {
+	today := s.Now().UTC().Truncate(24 * time.Hour)
+	cards, err := s.cards.InterestDueCards(today)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load the cards to accrue interest on: %w", err)
+	}
+
+	var postings []InterestPosting
+	var failures []InterestFailure
+	for i := range cards {
+		posted, err := s.accrueInterest(&cards[i], today)
+		if errors.Is(err, ErrInterestChanged) {
+			continue
+		}
+		if err != nil {
+			failures = append(failures, InterestFailure{CardNumber: cards[i].Number, Err: err})
+			continue
+		}
+		postings = append(postings, posted...)
+	}
+	return postings, failures, nil
+}
+
+// accrueInterest accrues the interest of the account of card for the days before today, and
+// credits it to card at the end of each month.
+func (s *Service) accrueInterest(card *Card, today time.Time) ([]InterestPosting, error) {
+	rate, err := s.InterestRate(card)
+	if err != nil {
+		return nil, err
+	}
+
+	var postings []InterestPosting
+	err = s.cards.Transaction(func(cards CardRepository) error {
+		postings = nil
+
+		account, err := cards.FindAccount(card.AccountID)
+		if err != nil {
+			return err
+		}
+		day := today.AddDate(0, 0, -1)
+		if opened := account.CreatedAt.UTC().Truncate(24 * time.Hour); opened.After(day) {
+			day = opened
+		}
+		if account.InterestAccruedUntil != nil {
+			day = account.InterestAccruedUntil.UTC()
+		}
+
+		// The balance of every day is replayed from the balance at its start and the entries made
+		// since, in the order of their dates.
+		entries, err := cards.Entries(EntryQuery{AccountID: account.ID, Since: day.Add(-time.Nanosecond)})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+		balance := account.Money()
+		for _, entry := range entries {
+			if balance, err = balance.Sub(signedAmount(entry)); err != nil {
+				return err
+			}
+		}
+
+		// The accrued interest is kept as Money counted in 1/InterestScale of a minor unit.
+		accrued := *account
+		pending := Money{Amount: account.AccruedInterest, Currency: account.Currency}
+		for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+			next := day.AddDate(0, 0, 1)
+			for ; len(entries) > 0 && entries[0].CreatedAt.Before(next); entries = entries[1:] {
+				if balance, err = balance.Add(signedAmount(entries[0])); err != nil {
+					return err
+				}
+			}
+
+			interest, err := dailyInterest(balance.Amount, rate)
+			if err != nil {
+				return err
+			}
+			if pending, err = pending.Add(Money{Amount: interest, Currency: account.Currency}); err != nil {
+				return err
+			}
+
+			if next.Day() != 1 {
+				continue
+			}
+			capitalized := Money{Amount: pending.Amount / InterestScale, Currency: account.Currency}
+			pending.Amount -= capitalized.Amount * InterestScale
+			if capitalized.Amount == 0 {
+				continue
+			}
+			if balance, err = balance.Add(capitalized); err != nil {
+				return err
+			}
+			updated, err := cards.UpdateBalance(card.Number, capitalized)
+			if err != nil {
+				return err
+			}
+			entry := s.ledgerEntry(KindInterest)
+			entry.CreatedAt = next
+			if err := recordEntries(cards, entry, nil, updated, capitalized, capitalized); err != nil {
+				return err
+			}
+			postings = append(postings, InterestPosting{
+				CardNumber: card.Number, Month: next.AddDate(0, -1, 0), Interest: capitalized, Rate: rate,
+			})
+		}
+		accrued.AccruedInterest = pending.Amount
+		accrued.InterestAccruedUntil = &today
+		return cards.UpdateInterest(account, &accrued)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return postings, nil
+}
+
+// signedAmount returns the amount entry adds to the balance of its account.
+func signedAmount(entry Transaction) Money {
+	if entry.Entry == EntryDebit {
+		return Money{Amount: -entry.Amount, Currency: entry.Currency}
+	}
+	return entry.Money()
+}
@@ -0,0 +1,318 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newInterestTestService returns a service whose clock reads *now and whose cards earn rate, and
+// a card holding balance since the start of the day before *now.
+func newInterestTestService(t *testing.T, now *time.Time, rate InterestRate, balance int64) (*Service, *Card) {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Clock = func() time.Time { return *now }
+	profile := DefaultIssuerProfile()
+	profile.InterestRate = rate
+	config.IssuerProfiles = IssuerProfiles{profile}
+	service := NewService(NewMemoryCardRepository(), config)
+	card, _, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	current := *now
+	*now = now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if err := service.Deposit(card, Money{Amount: balance, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	*now = current
+	return service, card
+}
+
+func accrueInterest(t *testing.T, service *Service) []InterestPosting {
+	t.Helper()
+
+	postings, failures, err := service.AccrueInterest()
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("cannot accrue interest: %v, %+v", err, failures)
+	}
+	return postings
+}
+
+func TestParseInterestRate(t *testing.T) {
+	for input, want := range map[string]InterestRate{"1.5": 150, "2.25%": 225, " 0 ": 0, "100": MaxInterestRate} {
+		if rate, err := ParseInterestRate(input); err != nil || rate != want {
+			t.Errorf("ParseInterestRate(%q) = %v, %v, want %v", input, rate, err, want)
+		}
+	}
+	for _, input := range []string{"0.125", "-1", "100.01", "one", ""} {
+		if rate, err := ParseInterestRate(input); !errors.Is(err, ErrInvalidInterestRate) {
+			t.Errorf("ParseInterestRate(%q) = %v, %v, want %v", input, rate, err, ErrInvalidInterestRate)
+		}
+	}
+	if s := InterestRate(105).String(); s != "1.05%" {
+		t.Errorf("1.05%% is formatted as %q", s)
+	}
+}
+
+func TestDailyInterestRoundsTowardZero(t *testing.T) {
+	for _, test := range []struct {
+		balance int64
+		rate    InterestRate
+		want    int64
+	}{
+		// 1000.00 at 3.65% earns exactly 0.10 a day.
+		{100000, 365, 10 * InterestScale},
+		// 3.33 at 5% earns 0.0456164383... cents a day.
+		{333, 500, 45616},
+		// 0.01 at 0.01% earns 0.00000027 cents a day, which is too little to accrue.
+		{1, 1, 0},
+		{0, MaxInterestRate, 0},
+	} {
+		if got, err := dailyInterest(test.balance, test.rate); err != nil || got != test.want {
+			t.Errorf("daily interest of %d at %v is %d, %v, want %d", test.balance, test.rate, got, err, test.want)
+		}
+	}
+	if _, err := dailyInterest(1<<62, MaxInterestRate); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("interest of a huge balance failed with %v, want %v", err, ErrAmountOverflow)
+	}
+}
+
+func TestAccrueInterestCapitalizesMonthly(t *testing.T) {
+	now := time.Date(2030, time.January, 2, 6, 0, 0, 0, time.UTC)
+	service, card := newInterestTestService(t, &now, 365, 100000)
+
+	// The first run accrues the day before it, January 1.
+	if postings := accrueInterest(t, service); len(postings) != 0 {
+		t.Errorf("credited %+v before the end of the month", postings)
+	}
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 10*InterestScale {
+		t.Errorf("accrued %d after a day, want 10 cents", account.AccruedInterest)
+	}
+
+	now = time.Date(2030, time.February, 1, 0, 0, 0, 0, time.UTC)
+	postings := accrueInterest(t, service)
+	want := InterestPosting{
+		CardNumber: card.Number,
+		Month:      time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Interest:   Money{Amount: 310, Currency: DefaultCurrency},
+		Rate:       365,
+	}
+	if len(postings) != 1 || postings[0] != want {
+		t.Fatalf("credited %+v, want %+v", postings, want)
+	}
+	if balance, _ := service.Balance(card.Number); balance.Amount != 100310 {
+		t.Errorf("balance is %v after capitalization, want 1003.10", balance)
+	}
+	if history, _ := service.History(card.Number, 1); len(history) != 1 || history[0].Kind != KindInterest || history[0].Amount != 310 {
+		t.Errorf("latest ledger entry is %+v, want the interest", history)
+	}
+	if postings := accrueInterest(t, service); len(postings) != 0 {
+		t.Errorf("running again the same day credited %+v", postings)
+	}
+
+	// February accrues on the capitalized balance: 28 days of 10.031 cents leave 0.868 cents
+	// to carry into March.
+	now = time.Date(2030, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if postings := accrueInterest(t, service); len(postings) != 1 || postings[0].Interest.Amount != 280 {
+		t.Errorf("credited %+v for February, want 2.80", postings)
+	}
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 868000 {
+		t.Errorf("carried %d into March, want 868000", account.AccruedInterest)
+	}
+}
+
+func TestAccrueInterestCarriesFractions(t *testing.T) {
+	now := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	service, card := newInterestTestService(t, &now, 100, 1000)
+	accrueInterest(t, service)
+
+	// 10.00 at 1% earns 0.027397 cents a day: not a cent by the end of December 31, accrued by
+	// the first run, nor by the end of January, so all of it is carried into February.
+	now = time.Date(2030, time.February, 1, 0, 0, 0, 0, time.UTC)
+	if postings := accrueInterest(t, service); len(postings) != 0 {
+		t.Errorf("credited %+v for January, want nothing", postings)
+	}
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 32*27397 {
+		t.Errorf("carried %d into February, want %d", account.AccruedInterest, 32*27397)
+	}
+
+	now = time.Date(2030, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if postings := accrueInterest(t, service); len(postings) != 1 || postings[0].Interest.Amount != 1 {
+		t.Errorf("credited %+v for February, want a cent", postings)
+	}
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 60*27397-InterestScale {
+		t.Errorf("carried %d into March, want %d", account.AccruedInterest, 60*27397-InterestScale)
+	}
+}
+
+func TestAccrueInterestCatchesUp(t *testing.T) {
+	now := time.Date(2030, time.January, 31, 0, 0, 0, 0, time.UTC)
+	service, card := newInterestTestService(t, &now, 365, 100000)
+	accrueInterest(t, service)
+
+	// January 31 to March 31 without a run: every month end is capitalized, and each month earns
+	// interest on the interest of the months before.
+	now = time.Date(2030, time.April, 1, 0, 0, 0, 0, time.UTC)
+	postings := accrueInterest(t, service)
+	if len(postings) != 3 || postings[0].Interest.Amount != 20 || postings[1].Interest.Amount != 280 || postings[2].Interest.Amount != 310 {
+		t.Fatalf("credited %+v, want 0.20, 2.80 and 3.10", postings)
+	}
+	if balance, _ := service.Balance(card.Number); balance.Amount != 100610 {
+		t.Errorf("balance is %v, want 1006.10", balance)
+	}
+	// The interest is dated when each month was capitalized, not when it was caught up on.
+	history, _ := service.History(card.Number, 3)
+	for i, month := range []time.Month{time.April, time.March, time.February} {
+		if want := time.Date(2030, month, 1, 0, 0, 0, 0, time.UTC); len(history) != 3 || !history[i].CreatedAt.Equal(want) {
+			t.Errorf("interest %d is dated %+v, want %v", i, history, want)
+		}
+	}
+}
+
+func TestAccrueInterestReplaysBalances(t *testing.T) {
+	now := time.Date(2030, time.January, 11, 0, 0, 0, 0, time.UTC)
+	service, card := newInterestTestService(t, &now, 365, 100000)
+	accrueInterest(t, service)
+
+	// A deposit at noon on January 20 and a run the next day: January 11 to 19 earn 0.10 a day on
+	// 1000.00, and January 20 earns 0.20 on the 2000.00 it ends with.
+	now = time.Date(2030, time.January, 20, 12, 0, 0, 0, time.UTC)
+	if err := service.Deposit(card, Money{Amount: 100000, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	now = time.Date(2030, time.January, 21, 0, 0, 0, 0, time.UTC)
+	accrueInterest(t, service)
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 120*InterestScale {
+		t.Errorf("accrued %d, want 1.20 with the 0.10 of January 10", account.AccruedInterest)
+	}
+
+	// A withdrawal made today does not count before today.
+	if err := service.Withdraw(card, Money{Amount: 200000, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("withdrawal failed: %v", err)
+	}
+	now = time.Date(2030, time.January, 22, 0, 0, 0, 0, time.UTC)
+	accrueInterest(t, service)
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 120*InterestScale {
+		t.Errorf("accrued %d after the balance was withdrawn, want 1.20", account.AccruedInterest)
+	}
+}
+
+func TestLateScheduledTransferKeepsCapitalizedInterest(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 12, 0, 0, 0, time.UTC)
+	service, card := newInterestTestService(t, &now, 365, 100000)
+	recipient, _, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	transfer, err := service.ScheduleTransfer(card, ScheduleRequest{
+		RecipientCardNumber: recipient.Number,
+		Amount:              Money{Amount: 50000, Currency: DefaultCurrency},
+		Schedule:            ScheduleOnce,
+		StartAt:             time.Date(2030, time.January, 20, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("cannot schedule transfer: %v", err)
+	}
+
+	// January 15 to 31 earn 0.10 a day on 1000.00, as the transfer did not run.
+	now = time.Date(2030, time.January, 16, 6, 0, 0, 0, time.UTC)
+	accrueInterest(t, service)
+	now = time.Date(2030, time.February, 1, 6, 0, 0, 0, time.UTC)
+	if postings := accrueInterest(t, service); len(postings) != 1 || postings[0].Interest.Amount != 170 {
+		t.Fatalf("credited %+v, want 1.70", postings)
+	}
+	january, err := service.MonthlyStatement(card, now.AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("cannot generate statement: %v", err)
+	}
+
+	// The transfer caught up on is dated when it ran, so the closed month and the interest it
+	// earned stay as they were.
+	now = time.Date(2030, time.February, 2, 6, 0, 0, 0, time.UTC)
+	if runs, err := service.RunDueTransfers(); err != nil || len(runs) != 1 || runs[0].Transfer.ID != transfer.ID || runs[0].Err != nil {
+		t.Fatalf("runs are %+v, %v, want the transfer done", runs, err)
+	}
+	if again, err := service.MonthlyStatement(card, january.Month); err != nil || again.Closing != january.Closing || len(again.Entries) != len(january.Entries) {
+		t.Errorf("statement of January is %+v, %v, want it unchanged from %+v", again, err, january)
+	}
+	february, err := service.MonthlyStatement(card, now)
+	if err != nil {
+		t.Fatalf("cannot generate statement: %v", err)
+	}
+	if february.Interest.Amount != 170 || february.Debits.Amount != 50000 || february.Closing.Amount != 50170 {
+		t.Errorf("statement of February is %+v, want the interest of January and the transfer", february)
+	}
+
+	// February 1 earns on 1001.70 and February 2 on the 501.70 left after the transfer.
+	now = time.Date(2030, time.February, 3, 6, 0, 0, 0, time.UTC)
+	accrueInterest(t, service)
+	if account, _ := service.cards.FindAccount(card.AccountID); account.AccruedInterest != 10_017_000+5_017_000 {
+		t.Errorf("accrued %d in February, want 0.15034", account.AccruedInterest)
+	}
+}
+
+func TestAccrueInterestReportsFailures(t *testing.T) {
+	now := time.Date(2030, time.January, 31, 0, 0, 0, 0, time.UTC)
+	service, failing := newInterestTestService(t, &now, MaxInterestRate, 1<<62)
+	card, _, err := service.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	if err := service.Deposit(card, Money{Amount: 100000, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+
+	// The interest of the first card overflows, which does not keep the second from accruing.
+	now = time.Date(2030, time.February, 1, 0, 0, 0, 0, time.UTC)
+	postings, failures, err := service.AccrueInterest()
+	if err != nil {
+		t.Fatalf("cannot accrue interest: %v", err)
+	}
+	if len(failures) != 1 || failures[0].CardNumber != failing.Number || !errors.Is(failures[0].Err, ErrAmountOverflow) {
+		t.Errorf("failed on %+v, want %s with %v", failures, failing.Number, ErrAmountOverflow)
+	}
+	if len(postings) != 1 || postings[0].CardNumber != card.Number {
+		t.Errorf("credited %+v, want the interest of %s", postings, card.Number)
+	}
+	if account, _ := service.cards.FindAccount(failing.AccountID); account.InterestAccruedUntil != nil {
+		t.Errorf("failed card accrued until %v, want its days left for a later run", account.InterestAccruedUntil)
+	}
+}
+
+func TestInterestRateOfCard(t *testing.T) {
+	now := time.Date(2030, time.January, 31, 0, 0, 0, 0, time.UTC)
+	service, card := newInterestTestService(t, &now, 100, 100000)
+
+	if rate, _ := service.InterestRate(card); rate != 100 {
+		t.Errorf("card earns %v, want the 1.00%% of its product", rate)
+	}
+	invalid := InterestRate(-5)
+	if err := service.SetInterestRate(card, &invalid); !errors.Is(err, ErrInvalidInterestRate) {
+		t.Errorf("setting a negative rate failed with %v, want %v", err, ErrInvalidInterestRate)
+	}
+	own := InterestRate(730)
+	if err := service.SetInterestRate(card, &own); err != nil {
+		t.Fatalf("cannot set interest rate: %v", err)
+	}
+
+	replacement, _, err := service.Reissue(card)
+	if err != nil {
+		t.Fatalf("cannot reissue card: %v", err)
+	}
+	if rate, _ := service.InterestRate(replacement); rate != own {
+		t.Errorf("replacement card earns %v, want %v", rate, own)
+	}
+	now = now.AddDate(0, 0, 1)
+	if postings := accrueInterest(t, service); len(postings) != 1 || postings[0].CardNumber != replacement.Number || postings[0].Interest.Amount != 20 {
+		t.Errorf("credited %+v, want 0.20 to the replacement card", postings)
+	}
+
+	if err := service.SetInterestRate(replacement, nil); err != nil {
+		t.Fatalf("cannot reset interest rate: %v", err)
+	}
+	if current, _ := service.GetCard(replacement.Number); current.InterestRate != nil {
+		t.Errorf("card keeps its own rate %v", *current.InterestRate)
+	}
+}
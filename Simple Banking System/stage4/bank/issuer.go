@@ -0,0 +1,166 @@
+package bank
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"stage4/cardnum"
+	"strings"
+)
+
+// Issuer profile defaults, matching the cards issued before the profiles were configurable
+const (
+	DefaultProduct    = "classic"
+	DefaultCardLength = 16
+	MinPINLength      = 4
+	MaxPINLength      = 12
+)
+
+// ErrUnknownProduct is returned when a card is requested for a product without issuer profile.
+var ErrUnknownProduct = errors.New("unknown card product")
+
+// IssuerProfile describes a product line of cards. The numbers of its cards start with BIN and
+// have Length digits, the last one being the Luhn check digit, and their PINs have PINLength
+// digits. Its cards earn InterestRate unless they have a rate of their own.
+type IssuerProfile struct {
+	Product      string       `json:"product"`
+	BIN          string       `json:"bin"`
+	Length       int          `json:"length"`
+	PINLength    int          `json:"pinLength"`
+	InterestRate InterestRate `json:"interestRate"` // in basis points
+}
+
+func DefaultIssuerProfile() IssuerProfile {
+	return IssuerProfile{Product: DefaultProduct, BIN: CardPrefix, Length: DefaultCardLength, PINLength: PinDigits}
+}
+
+// check reports the first field of the profile that cannot describe a card.
+func (p IssuerProfile) check() error {
+	switch {
+	case p.Product == "":
+		return errors.New("the product name is empty")
+	case p.Length < cardnum.MinLength || p.Length > cardnum.MaxLength:
+		return fmt.Errorf("the length must be %d to %d digits", cardnum.MinLength, cardnum.MaxLength)
+	case p.BIN == "" || strings.Trim(p.BIN, "0123456789") != "":
+		return errors.New("the BIN must be a number")
+	case len(p.BIN) >= p.Length-1:
+		return errors.New("the BIN leaves no digits for the account number")
+	case p.PINLength < MinPINLength || p.PINLength > MaxPINLength:
+		return fmt.Errorf("the PIN length must be %d to %d digits", MinPINLength, MaxPINLength)
+	case p.InterestRate.check() != nil:
+		return fmt.Errorf("the interest rate must be 0 to %d basis points", MaxInterestRate)
+	}
+	return nil
+}
+
+// GenerateCardNumberAndPIN returns a random Luhn-valid card number of the profile and a random PIN.
+func (p IssuerProfile) GenerateCardNumberAndPIN() (string, string, error) {
+	digits, err := generateRandomDigits(p.Length - len(p.BIN) - 1)
+	if err != nil {
+		return "", "", err
+	}
+	cardBase := p.BIN + digits
+	checksum, err := cardnum.ComputeCheckDigit(cardBase)
+	if err != nil {
+		return "", "", err
+	}
+	cardNumber := cardBase + fmt.Sprintf("%d", checksum)
+
+	pin, err := generateRandomDigits(p.PINLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	return cardNumber, pin, nil
+}
+
+// ValidateCardNumber checks that number is a valid card number of the profile.
+func (p IssuerProfile) ValidateCardNumber(number string) error {
+	if err := (cardnum.Validator{MinLength: p.Length, MaxLength: p.Length}).Validate(number); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(number, p.BIN) {
+		return fmt.Errorf("card number does not start with BIN %s", p.BIN)
+	}
+	return nil
+}
+
+// IssuerProfiles are the product lines cards are issued for. The first one is the default.
+type IssuerProfiles []IssuerProfile
+
+// DefaultIssuerProfiles only issue cards of DefaultIssuerProfile.
+func DefaultIssuerProfiles() IssuerProfiles {
+	return IssuerProfiles{DefaultIssuerProfile()}
+}
+
+// Find returns the profile of product, or the default profile when product is empty. It fails
+// with ErrUnknownProduct if there is no such profile.
+func (ps IssuerProfiles) Find(product string) (IssuerProfile, error) {
+	if product == "" && len(ps) != 0 {
+		return ps[0], nil
+	}
+	for _, profile := range ps {
+		if profile.Product == product {
+			return profile, nil
+		}
+	}
+	return IssuerProfile{}, fmt.Errorf("%w: %q", ErrUnknownProduct, product)
+}
+
+// ValidateCardNumber checks that number is a valid card number of one of the profiles. The
+// error of the profile with the longest matching BIN is returned when none accepts it.
+func (ps IssuerProfiles) ValidateCardNumber(number string) error {
+	err := cardnum.Validate(number)
+	if err != nil {
+		return err
+	}
+
+	bin := ""
+	err = errors.New("card number matches no issuer profile")
+	for _, profile := range ps {
+		profileErr := profile.ValidateCardNumber(number)
+		if profileErr == nil {
+			return nil
+		}
+		if strings.HasPrefix(number, profile.BIN) && len(profile.BIN) > len(bin) {
+			bin, err = profile.BIN, profileErr
+		}
+	}
+	return err
+}
+
+// LoadIssuerProfiles reads the issuer profiles from the JSON file at path, which holds an array
+// of profiles such as
+//
+//	[{"product": "classic", "bin": "400000", "length": 16, "pinLength": 4}]
+//
+// The first profile is the default. The profiles of the cards already issued must be kept, or
+// money can no longer be transferred to those cards.
+func LoadIssuerProfiles(path string) (IssuerProfiles, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var profiles IssuerProfiles
+	if err := json.NewDecoder(file).Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("cannot read issuer profiles from %s: %v", path, err)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no issuer profiles in %s", path)
+	}
+
+	products := map[string]bool{}
+	for _, profile := range profiles {
+		if err := profile.check(); err != nil {
+			return nil, fmt.Errorf("invalid issuer profile %q in %s: %v", profile.Product, path, err)
+		}
+		if products[profile.Product] {
+			return nil, fmt.Errorf("duplicate issuer profile %q in %s", profile.Product, path)
+		}
+		products[profile.Product] = true
+	}
+	return profiles, nil
+}
@@ -0,0 +1,112 @@
+package bank
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"stage4/cardnum"
+	"strings"
+	"testing"
+)
+
+var testIssuerProfiles = IssuerProfiles{
+	DefaultIssuerProfile(),
+	{Product: "gold", BIN: "51234", Length: 19, PINLength: 6},
+	{Product: "corporate", BIN: "3712", Length: 15, PINLength: 4},
+}
+
+func TestGenerateCardNumberAndPIN(t *testing.T) {
+	for _, profile := range testIssuerProfiles {
+		number, pin, err := profile.GenerateCardNumberAndPIN()
+		if err != nil {
+			t.Fatalf("cannot generate %s card: %v", profile.Product, err)
+		}
+		if err := profile.ValidateCardNumber(number); err != nil {
+			t.Errorf("generated %s card number %s is invalid: %v", profile.Product, number, err)
+		}
+		if len(pin) != profile.PINLength || strings.Trim(pin, "0123456789") != "" {
+			t.Errorf("generated %s PIN %q does not have %d digits", profile.Product, pin, profile.PINLength)
+		}
+	}
+}
+
+func TestIssuerProfilesValidateCardNumber(t *testing.T) {
+	for number, valid := range map[string]bool{
+		"4000000000000002":    true,
+		"4000000000000003":    false,
+		"4000010000000000":    false,
+		"4111111111111111":    false,
+		"371200000000007":     true,
+		"5123400000000000001": true,
+		"512340000000000003":  false,
+		"":                    false,
+	} {
+		if err := testIssuerProfiles.ValidateCardNumber(number); (err == nil) != valid {
+			t.Errorf("ValidateCardNumber(%q) = %v, want valid %t", number, err, valid)
+		}
+	}
+	if err := testIssuerProfiles.ValidateCardNumber("4000000000000003"); !errors.Is(err, cardnum.ErrCheckDigit) {
+		t.Errorf("wrong check digit reported as %v, want %v", err, cardnum.ErrCheckDigit)
+	}
+}
+
+func TestCreateAccountWithProduct(t *testing.T) {
+	config := DefaultConfig()
+	config.IssuerProfiles = testIssuerProfiles
+	service := NewService(NewMemoryCardRepository(), config)
+
+	card, pin, err := service.CreateAccount(DefaultCurrency, "gold")
+	if err != nil {
+		t.Fatalf("cannot create gold card: %v", err)
+	}
+	if card.Product != "gold" || !strings.HasPrefix(card.Number, "51234") || len(card.Number) != 19 || len(pin) != 6 {
+		t.Errorf("gold card is %s %s with PIN %s", card.Product, card.Number, pin)
+	}
+
+	if card, _, err = service.CreateAccount(DefaultCurrency, ""); err != nil || card.Product != DefaultProduct {
+		t.Errorf("card without product is %v, %v, want a %s card", card, err, DefaultProduct)
+	}
+	if _, _, err = service.CreateAccount(DefaultCurrency, "platinum"); !errors.Is(err, ErrUnknownProduct) {
+		t.Errorf("unknown product failed with %v, want %v", err, ErrUnknownProduct)
+	}
+}
+
+func TestLoadIssuerProfiles(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "issuers.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("cannot write issuer profiles: %v", err)
+		}
+		return path
+	}
+
+	profiles, err := LoadIssuerProfiles(write(`[
+		{"product": "gold", "bin": "51234", "length": 19, "pinLength": 6, "interestRate": 125},
+		{"product": "classic", "bin": "400000", "length": 16, "pinLength": 4}
+	]`))
+	if err != nil {
+		t.Fatalf("cannot load issuer profiles: %v", err)
+	}
+	if profile, _ := profiles.Find(""); profile != profiles[0] || profile.Product != "gold" {
+		t.Errorf("default profile is %+v, want the first one", profile)
+	}
+	if profiles[0].InterestRate != 125 || profiles[1].InterestRate != 0 {
+		t.Errorf("interest rates are %v and %v, want 1.25%% and none", profiles[0].InterestRate, profiles[1].InterestRate)
+	}
+
+	for name, content := range map[string]string{
+		"empty":            `[]`,
+		"duplicate":        `[{"product": "a", "bin": "4", "length": 16, "pinLength": 4}, {"product": "a", "bin": "5", "length": 16, "pinLength": 4}]`,
+		"no product":       `[{"bin": "4", "length": 16, "pinLength": 4}]`,
+		"short number":     `[{"product": "a", "bin": "4", "length": 12, "pinLength": 4}]`,
+		"long BIN":         `[{"product": "a", "bin": "400000000000000", "length": 16, "pinLength": 4}]`,
+		"BIN with letters": `[{"product": "a", "bin": "4x", "length": 16, "pinLength": 4}]`,
+		"short PIN":        `[{"product": "a", "bin": "4", "length": 16, "pinLength": 3}]`,
+		"negative rate":    `[{"product": "a", "bin": "4", "length": 16, "pinLength": 4, "interestRate": -1}]`,
+		"not JSON":         `product,bin`,
+	} {
+		if _, err := LoadIssuerProfiles(write(content)); err == nil {
+			t.Errorf("%s issuer profiles were loaded", name)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package bank
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Ledger entry sides and kinds
+const (
+	EntryDebit  = "debit"
+	EntryCredit = "credit"
+
+	KindIncome     = "income"
+	KindTransfer   = "transfer"
+	KindWithdrawal = "withdrawal"
+	KindPayout     = "payout"
+	KindInterest   = "interest"
+
+	// ExternalAccount is the counterparty of money entering the system through deposits and
+	// interest, and leaving it through withdrawals.
+	ExternalAccount = "external"
+
+	ReferenceBytes = 16
+	RateDecimals   = 10
+)
+
+// Transaction is a single ledger entry. Every balance change writes a debit and a credit entry
+// sharing the same Reference, so balances can be re-derived from the ledger and audited.
+type Transaction struct {
+	gorm.Model
+	Reference    string `gorm:"index;not null"`
+	CardNumber   string `gorm:"index;not null"`
+	Counterparty string `gorm:"not null"`
+	Kind         string `gorm:"not null"`
+	Entry        string `gorm:"not null"`
+	Amount       int64  `gorm:"not null"` // in minor units of Currency
+	Currency     string `gorm:"not null;default:USD"`
+	// Rate is the exchange rate applied when the transfer converted between currencies.
+	Rate string
+	// AccountID is the account of the card, nil for the entries of ExternalAccount.
+	AccountID *uint `gorm:"index"`
+	// ScheduledFor is when the run of the scheduled transfer that made the entry was due, nil for
+	// other entries. The entry itself is dated when the money moved.
+	ScheduledFor *time.Time
+}
+
+// Money returns the amount of the entry.
+func (t *Transaction) Money() Money {
+	return Money{Amount: t.Amount, Currency: t.Currency}
+}
+
+// Deposit adds income to the balance of card and records it in the ledger. The balance is
+// increased in the repository rather than from the copy in card, which is then refreshed.
+func (s *Service) Deposit(card *Card, income Money) error {
+	if income.Currency != card.Currency {
+		return fmt.Errorf("%w: cannot deposit %s on a %s card", ErrCurrencyMismatch, income.Currency, card.Currency)
+	}
+	if err := s.config.DepositLimits.Check(income); err != nil {
+		return err
+	}
+
+	var updated *Card
+	err := s.cards.Transaction(func(cards CardRepository) error {
+		var err error
+		if updated, err = cards.UpdateBalance(card.Number, income); err != nil {
+			return err
+		}
+		if err := recordEntries(cards, s.ledgerEntry(KindIncome), nil, updated, income, income); err != nil {
+			return fmt.Errorf("cannot record income: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*card = *updated
+	return nil
+}
+
+// CheckRecipient checks that money can be transferred from sender to recipientCardNumber and
+// loads the recipient card.
+func (s *Service) CheckRecipient(sender *Card, recipientCardNumber string) (*Card, error) {
+	if sender.Number == recipientCardNumber {
+		return nil, ErrSameAccount
+	}
+
+	if err := s.IssuerProfiles().ValidateCardNumber(recipientCardNumber); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCardNumber, err)
+	}
+
+	return s.GetCard(recipientCardNumber)
+}
+
+// Transfer moves amount, given in the currency of sender, to the card with number
+// recipientCardNumber, converting it if the recipient holds another currency.
+func (s *Service) Transfer(sender *Card, recipientCardNumber string, amount Money) error {
+	recipient, err := s.CheckRecipient(sender, recipientCardNumber)
+	if err != nil {
+		return err
+	}
+
+	if amount.Currency != sender.Currency {
+		return fmt.Errorf("%w: cannot transfer %s from a %s card", ErrCurrencyMismatch, amount.Currency, sender.Currency)
+	}
+	if err := s.config.TransferLimits.Check(amount); err != nil {
+		return err
+	}
+
+	return s.ExecuteTransfer(sender, recipient, amount)
+}
+
+// ExecuteTransfer atomically moves amount from sender to recipient and records it in the ledger.
+// Both cards are refreshed with the balances written by the transfer. The funds are checked
+// by the debit itself, so a balance in sender that is out of date cannot allow an overdraft.
+func (s *Service) ExecuteTransfer(sender *Card, recipient *Card, amount Money) error {
+	var debited, credited *Card
+	err := s.cards.Transaction(func(cards CardRepository) error {
+		var err error
+		debited, credited, err = s.moveMoney(cards, s.ledgerEntry(KindTransfer), sender.Number, recipient, amount)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	*sender, *recipient = *debited, *credited
+	return nil
+}
+
+// moveMoney debits amount from the card with number senderNumber, credits it to recipient,
+// converted to its currency, and records the entries with the fields set in entry. It returns both
+// updated cards. It must run inside a transaction of cards.
+func (s *Service) moveMoney(cards CardRepository, entry Transaction, senderNumber string, recipient *Card, amount Money) (*Card, *Card, error) {
+	credit, rate, err := s.convert(amount, recipient.Currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	debited, credited, err := cards.Transfer(senderNumber, recipient.Number, amount, credit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry.Rate = rate
+	if err := recordEntries(cards, entry, debited, credited, amount, credit); err != nil {
+		return nil, nil, fmt.Errorf("cannot record %s: %w", entry.Kind, err)
+	}
+	return debited, credited, nil
+}
+
+// convert converts amount into currency with the configured exchange rates. It returns the
+// converted amount and the rate applied, which is empty if no conversion was needed.
+func (s *Service) convert(amount Money, currency string) (Money, string, error) {
+	if amount.Currency == currency {
+		return amount, "", nil
+	}
+	if s.config.ExchangeRates == nil {
+		return Money{}, "", fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, amount.Currency, currency)
+	}
+
+	rate, err := s.config.ExchangeRates.Rate(amount.Currency, currency)
+	if err != nil {
+		return Money{}, "", err
+	}
+	converted, err := Convert(amount, currency, rate)
+	if err != nil {
+		return Money{}, "", err
+	}
+	return converted, formatRate(rate), nil
+}
+
+// formatRate formats rate as a decimal with up to RateDecimals fractional digits.
+func formatRate(rate *big.Rat) string {
+	formatted := rate.FloatString(RateDecimals)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+// ledgerEntry returns the fields shared by the debit and credit entries of an operation of kind
+// done now by the clock of the Service.
+func (s *Service) ledgerEntry(kind string) Transaction {
+	return Transaction{Model: gorm.Model{CreatedAt: s.Now().UTC()}, Kind: kind}
+}
+
+// recordEntries writes the paired debit and credit ledger entries, sharing the fields set in
+// entry, for moving debit out of the debited card and credit into the credited one, where nil
+// stands for ExternalAccount; the two amounts differ only when the money was converted at
+// entry.Rate. It must run inside the transaction that changes the balances.
+func recordEntries(cards CardRepository, entry Transaction, debited, credited *Card, debit, credit Money) error {
+	var err error
+	if entry.Reference, err = generateReference(); err != nil {
+		return err
+	}
+
+	debitEntry, creditEntry := entry, entry
+	debitEntry.CardNumber, debitEntry.AccountID = ledgerAccount(debited)
+	creditEntry.CardNumber, creditEntry.AccountID = ledgerAccount(credited)
+	debitEntry.Counterparty, creditEntry.Counterparty = creditEntry.CardNumber, debitEntry.CardNumber
+	debitEntry.Entry, debitEntry.Amount, debitEntry.Currency = EntryDebit, debit.Amount, debit.Currency
+	creditEntry.Entry, creditEntry.Amount, creditEntry.Currency = EntryCredit, credit.Amount, credit.Currency
+	return cards.AddEntries([]Transaction{debitEntry, creditEntry})
+}
+
+// ledgerAccount returns the card number and account the entries of card are recorded under.
+func ledgerAccount(card *Card) (string, *uint) {
+	if card == nil {
+		return ExternalAccount, nil
+	}
+	accountID := card.AccountID
+	return card.Number, &accountID
+}
+
+func generateReference() (string, error) {
+	b := make([]byte, ReferenceBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate transaction reference: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// History returns the latest limit ledger entries of the account of the card with the given
+// number, newest first. They include the entries made with the cards it replaced.
+func (s *Service) History(cardNumber string, limit int) ([]Transaction, error) {
+	card, err := s.cards.FindByNumber(cardNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.cards.Entries(EntryQuery{AccountID: card.AccountID, NewestFirst: true, Limit: limit})
+}
@@ -0,0 +1,117 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLedgerPairsEntries(t *testing.T) {
+	service := newTestService(t, DefaultConfig())
+	sender := createTestCard(t, service.cards, "4000003972196502", 0)
+	recipient := createTestCard(t, service.cards, "4000000000000002", 0)
+
+	if err := service.Deposit(sender, usd(100)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if err := service.Transfer(sender, recipient.Number, usd(30)); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	// A transfer that fails leaves no entries.
+	if err := service.Transfer(sender, recipient.Number, usd(80)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("overdraft failed with %v, want %v", err, ErrInsufficientFunds)
+	}
+
+	var entries []Transaction
+	if err := serviceDB(service).Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("cannot load the ledger: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("ledger has %d entries, want a pair for the deposit and one for the transfer", len(entries))
+	}
+	pairs := map[string][]Transaction{}
+	balances := map[string]int64{}
+	for _, entry := range entries {
+		pairs[entry.Reference] = append(pairs[entry.Reference], entry)
+		if entry.Entry == EntryDebit {
+			balances[entry.CardNumber] -= entry.Amount
+		} else {
+			balances[entry.CardNumber] += entry.Amount
+		}
+	}
+	for reference, pair := range pairs {
+		if len(pair) != 2 || pair[0].Entry == pair[1].Entry || pair[0].Amount != pair[1].Amount ||
+			pair[0].Kind != pair[1].Kind || pair[0].CardNumber != pair[1].Counterparty || pair[1].CardNumber != pair[0].Counterparty {
+			t.Errorf("entries of %s are not a debit and a credit of each other: %+v", reference, pair)
+		}
+	}
+
+	// The balances are re-derived from the ledger.
+	want := map[string]int64{ExternalAccount: -100, sender.Number: 70, recipient.Number: 30}
+	for number, balance := range want {
+		if balances[number] != balance {
+			t.Errorf("ledger gives %s a balance of %d, want %d", number, balances[number], balance)
+		}
+	}
+	for number, balance := range want {
+		if number == ExternalAccount {
+			continue
+		}
+		if stored, err := service.Balance(number); err != nil || stored != usd(balance) {
+			t.Errorf("card %s holds %v, %v, want %v", number, stored, err, usd(balance))
+		}
+	}
+
+	history, err := service.History(recipient.Number, 10)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("history of the recipient is %+v, %v, want the transfer", history, err)
+	}
+	if entry := history[0]; entry.Kind != KindTransfer || entry.Entry != EntryCredit || entry.Counterparty != sender.Number {
+		t.Errorf("recipient has %+v, want the credit of the transfer from %s", entry, sender.Number)
+	}
+}
+
+func TestStaleCardsDoNotLoseUpdates(t *testing.T) {
+	teller := newTestService(t, DefaultConfig())
+	other := NewService(teller.cards, DefaultConfig())
+	created, pin, err := teller.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+	recipient, _, err := teller.CreateAccount(DefaultCurrency, "")
+	if err != nil {
+		t.Fatalf("cannot create card: %v", err)
+	}
+
+	// Both sessions log in, then each changes the balance behind the back of the other.
+	card, err := teller.Authenticate(created.Number, pin)
+	if err != nil {
+		t.Fatalf("cannot log in: %v", err)
+	}
+	stale, err := other.Authenticate(created.Number, pin)
+	if err != nil {
+		t.Fatalf("cannot log in: %v", err)
+	}
+	if err := teller.Deposit(card, usd(1000)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if err := other.Deposit(stale, usd(500)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if stale.Balance != 1500 || stale.WholeBalance != 15 {
+		t.Errorf("card holds %d and %d whole units after the second deposit, want both deposits", stale.Balance, stale.WholeBalance)
+	}
+
+	// card still shows 10.00, but the transfer is checked against the stored 15.00.
+	if err := teller.ExecuteTransfer(card, recipient, usd(1200)); err != nil {
+		t.Fatalf("transfer of money deposited by the other session failed: %v", err)
+	}
+	if card.Balance != 300 || recipient.Balance != 1200 {
+		t.Errorf("cards hold %d and %d after the transfer, want 300 and 1200", card.Balance, recipient.Balance)
+	}
+	if err := other.ExecuteTransfer(stale, recipient, usd(1000)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("overdraft from an out of date card failed with %v, want %v", err, ErrInsufficientFunds)
+	}
+	if balance, _ := other.Balance(created.Number); balance != usd(300) {
+		t.Errorf("balance is %v, want 3.00 USD", balance)
+	}
+}
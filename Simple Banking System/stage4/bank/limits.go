@@ -0,0 +1,95 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrAmountLimit is matched by AmountLimitError.
+var ErrAmountLimit = errors.New("amount outside the allowed limits")
+
+// AmountLimits bounds the amount of a single deposit or transfer, in major units of the currency
+// of the card (e.g. 12.5 is 12.50 USD or 12.500 KWD). A nil bound is not enforced.
+type AmountLimits struct {
+	Min *big.Rat
+	Max *big.Rat
+}
+
+// AmountLimitError is returned for amounts outside AmountLimits. It matches ErrAmountLimit.
+type AmountLimitError struct {
+	Amount Money
+	// Limit is the bound that Amount violates.
+	Limit *big.Rat
+	// Minimum is true when Amount is below Limit and false when it is above it.
+	Minimum bool
+}
+
+func (e *AmountLimitError) Error() string {
+	bound := "at most"
+	if e.Minimum {
+		bound = "at least"
+	}
+	return fmt.Sprintf("%v: %v must be %s %s", ErrAmountLimit, e.Amount, bound, e.FormatLimit())
+}
+
+// FormatLimit formats Limit in the currency of Amount, e.g. "100.00 USD".
+func (e *AmountLimitError) FormatLimit() string {
+	exponent, err := CurrencyExponent(e.Amount.Currency)
+	if err != nil {
+		return e.Limit.RatString()
+	}
+	return e.Limit.FloatString(exponent) + " " + e.Amount.Currency
+}
+
+func (e *AmountLimitError) Is(target error) bool {
+	return target == ErrAmountLimit
+}
+
+// Check returns ErrInvalidAmount if amount is not positive and an *AmountLimitError if it is
+// outside l.
+func (l AmountLimits) Check(amount Money) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	value, err := amount.Rat()
+	if err != nil {
+		return err
+	}
+	if l.Min != nil && value.Cmp(l.Min) < 0 {
+		return &AmountLimitError{Amount: amount, Limit: l.Min, Minimum: true}
+	}
+	if l.Max != nil && value.Cmp(l.Max) > 0 {
+		return &AmountLimitError{Amount: amount, Limit: l.Max}
+	}
+	return nil
+}
+
+// ParseAmountLimit parses a positive decimal bound for AmountLimits, e.g. "0.01" or "10000". As
+// the bound applies to cards of every currency, it may have as many decimals as the currency with
+// the most minor units, and no more.
+func ParseAmountLimit(s string) (*big.Rat, error) {
+	value := strings.TrimSpace(s)
+	whole, fraction, hasFraction := strings.Cut(value, ".")
+	if whole == "" && fraction == "" || hasFraction && fraction == "" || len(fraction) > maxCurrencyExponent() ||
+		!isDigits(whole) || !isDigits(fraction) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+
+	limit, _ := new(big.Rat).SetString(value)
+	if limit.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return limit, nil
+}
+
+// maxCurrencyExponent returns the most minor units a supported currency has.
+func maxCurrencyExponent() int {
+	exponent := 0
+	for _, e := range currencyExponents {
+		exponent = max(exponent, e)
+	}
+	return exponent
+}
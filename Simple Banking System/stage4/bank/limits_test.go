@@ -0,0 +1,96 @@
+package bank
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParseAmountLimit(t *testing.T) {
+	for input, want := range map[string]string{"10000": "10000", "0.01": "1/100", " 12.5 ": "25/2", "0.001": "1/1000", ".5": "1/2"} {
+		if limit, err := ParseAmountLimit(input); err != nil || limit.RatString() != want {
+			t.Errorf("ParseAmountLimit(%q) = %v, %v, want %s", input, limit, err, want)
+		}
+	}
+	for _, input := range []string{"1/3", "1e3", "0.0001", "-5", "+5", "1.", "", "ten", "0x10", "1_000"} {
+		if limit, err := ParseAmountLimit(input); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseAmountLimit(%q) = %v, %v, want %v", input, limit, err, ErrInvalidMoney)
+		}
+	}
+	for _, input := range []string{"0", "0.000"} {
+		if limit, err := ParseAmountLimit(input); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("ParseAmountLimit(%q) = %v, %v, want %v", input, limit, err, ErrInvalidAmount)
+		}
+	}
+}
+
+func TestAmountLimitsCheckBounds(t *testing.T) {
+	limits := AmountLimits{Min: big.NewRat(1, 1), Max: big.NewRat(100, 1)}
+	for _, test := range []struct {
+		amount  Money
+		minimum bool
+		ok      bool
+	}{
+		{Money{Amount: 100, Currency: "USD"}, false, true},
+		{Money{Amount: 10000, Currency: "USD"}, false, true},
+		{Money{Amount: 99, Currency: "USD"}, true, false},
+		{Money{Amount: 10001, Currency: "USD"}, false, false},
+		// The bounds are in major units, so 1.000 KWD is allowed and 0.999 KWD is not.
+		{Money{Amount: 1000, Currency: "KWD"}, false, true},
+		{Money{Amount: 999, Currency: "KWD"}, true, false},
+		{Money{Amount: 100, Currency: "JPY"}, false, true},
+		{Money{Amount: 101, Currency: "JPY"}, false, false},
+	} {
+		err := limits.Check(test.amount)
+		var limitErr *AmountLimitError
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%v is refused: %v", test.amount, err)
+		case !test.ok && (!errors.As(err, &limitErr) || limitErr.Minimum != test.minimum):
+			t.Errorf("%v failed with %v, want a limit error with Minimum %t", test.amount, err, test.minimum)
+		}
+	}
+	if err := limits.Check(Money{Currency: "USD"}); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("zero failed with %v, want %v", err, ErrInvalidAmount)
+	}
+	if err := (AmountLimits{}).Check(Money{Amount: 1 << 62, Currency: "USD"}); err != nil {
+		t.Errorf("unbounded limits refused a huge amount: %v", err)
+	}
+}
+
+func TestServiceEnforcesAmountLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.DepositLimits = AmountLimits{Min: big.NewRat(1, 1), Max: big.NewRat(1000, 1)}
+	config.TransferLimits = AmountLimits{Max: big.NewRat(50, 1)}
+	service := newTestService(t, config)
+	card := createTestCard(t, service.cards, "4000003972196502", 0)
+	recipient := createTestCard(t, service.cards, "4000000000000010", 0)
+
+	for _, test := range []struct {
+		amount int64
+		want   error
+	}{
+		{99, ErrAmountLimit},
+		{100001, ErrAmountLimit},
+		{0, ErrInvalidAmount},
+		{100, nil},
+		{100000, nil},
+	} {
+		if err := service.Deposit(card, usd(test.amount)); !errors.Is(err, test.want) {
+			t.Errorf("deposit of %v failed with %v, want %v", usd(test.amount), err, test.want)
+		}
+	}
+	if err := service.Deposit(card, Money{Amount: 100, Currency: "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("deposit of EUR on a USD card failed with %v, want %v", err, ErrCurrencyMismatch)
+	}
+
+	if err := service.Transfer(card, recipient.Number, usd(5001)); !errors.Is(err, ErrAmountLimit) {
+		t.Errorf("transfer over the limit failed with %v, want %v", err, ErrAmountLimit)
+	}
+	if err := service.Transfer(card, recipient.Number, usd(5000)); err != nil {
+		t.Errorf("transfer at the limit failed: %v", err)
+	}
+	if balance, _ := service.Balance(recipient.Number); balance != usd(5000) {
+		t.Errorf("recipient holds %v, want only the transfer at the limit", balance)
+	}
+}
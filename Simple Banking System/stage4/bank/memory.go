@@ -0,0 +1,503 @@
+package bank
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryCardRepository is a CardRepository that keeps everything in memory. It is meant for tests
+// and demos: nothing survives the process. Transactions are serialized.
+type MemoryCardRepository struct {
+	mu    *sync.Mutex
+	state *memoryState
+	// inTransaction is set on the repository given to a transaction, which already holds mu.
+	inTransaction bool
+}
+
+type memoryState struct {
+	cards          map[string]Card
+	accounts       map[uint]Account
+	customers      map[uint]Customer
+	scheduled      map[uint]ScheduledTransfer
+	entries        []Transaction
+	lastCardID     uint
+	lastAccountID  uint
+	lastCustomerID uint
+	lastScheduleID uint
+	lastEntryID    uint
+}
+
+func NewMemoryCardRepository() *MemoryCardRepository {
+	return &MemoryCardRepository{
+		mu: &sync.Mutex{},
+		state: &memoryState{
+			cards:     map[string]Card{},
+			accounts:  map[uint]Account{},
+			customers: map[uint]Customer{},
+			scheduled: map[uint]ScheduledTransfer{},
+		},
+	}
+}
+
+func (st *memoryState) clone() *memoryState {
+	clone := *st
+	clone.cards = make(map[string]Card, len(st.cards))
+	for number, card := range st.cards {
+		clone.cards[number] = card
+	}
+	clone.accounts = make(map[uint]Account, len(st.accounts))
+	for id, account := range st.accounts {
+		clone.accounts[id] = account
+	}
+	clone.customers = make(map[uint]Customer, len(st.customers))
+	for id, customer := range st.customers {
+		clone.customers[id] = customer
+	}
+	clone.scheduled = make(map[uint]ScheduledTransfer, len(st.scheduled))
+	for id, transfer := range st.scheduled {
+		clone.scheduled[id] = transfer
+	}
+	clone.entries = append([]Transaction(nil), st.entries...)
+	return &clone
+}
+
+// lock locks the repository unless it belongs to a transaction, and returns the matching unlock.
+func (r *MemoryCardRepository) lock() func() {
+	if r.inTransaction {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+func (r *MemoryCardRepository) Transaction(fn func(cards CardRepository) error) error {
+	if r.inTransaction {
+		return fn(r)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.state.clone()
+	if err := fn(&MemoryCardRepository{mu: r.mu, state: r.state, inTransaction: true}); err != nil {
+		*r.state = *snapshot
+		return err
+	}
+	return nil
+}
+
+func (r *MemoryCardRepository) FindByNumber(number string) (*Card, error) {
+	defer r.lock()()
+
+	card, ok := r.state.cards[number]
+	if !ok {
+		return nil, ErrCardNotFound
+	}
+	return r.withBalance(card), nil
+}
+
+// openCard returns the stored open card with the given number. The caller must hold the lock.
+func (r *MemoryCardRepository) openCard(number string) (Card, error) {
+	card, ok := r.state.cards[number]
+	if !ok {
+		return Card{}, ErrCardNotFound
+	}
+	if card.DeletedAt.Valid {
+		return Card{}, deactivationError(&card)
+	}
+	return card, nil
+}
+
+// withBalance returns a copy of card with the balance of its account. The caller must hold the
+// lock.
+func (r *MemoryCardRepository) withBalance(card Card) *Card {
+	card.setBalance(r.state.accounts[card.AccountID].Balance)
+	return &card
+}
+
+func (r *MemoryCardRepository) Create(card *Card) error {
+	defer r.lock()()
+
+	if _, ok := r.state.cards[card.Number]; ok {
+		return fmt.Errorf("%w: %s", ErrCardNumberTaken, card.Number)
+	}
+
+	r.state.lastCardID++
+	now := time.Now()
+	card.ID, card.CreatedAt, card.UpdatedAt = r.state.lastCardID, now, now
+	if card.Currency == "" {
+		card.Currency = DefaultCurrency
+	}
+	if card.Product == "" {
+		card.Product = DefaultProduct
+	}
+	if card.Status == "" {
+		card.Status = StatusActive
+	}
+	if card.AccountID == 0 {
+		r.state.lastAccountID++
+		card.AccountID = r.state.lastAccountID
+		r.state.accounts[card.AccountID] = Account{
+			Model:    gorm.Model{ID: card.AccountID, CreatedAt: now, UpdatedAt: now},
+			Currency: card.Currency,
+		}
+	} else if _, ok := r.state.accounts[card.AccountID]; !ok {
+		return fmt.Errorf("account %d of card %s not found", card.AccountID, card.Number)
+	}
+	r.state.cards[card.Number] = *card
+	return nil
+}
+
+func (r *MemoryCardRepository) UpdateBalance(number string, delta Money) (*Card, error) {
+	defer r.lock()()
+
+	card, err := r.openCard(number)
+	if err != nil {
+		return nil, err
+	}
+	if delta.Currency != card.Currency {
+		return nil, fmt.Errorf("%w: %s on a %s card", ErrCurrencyMismatch, delta.Currency, card.Currency)
+	}
+	if delta.Amount == math.MinInt64 {
+		return nil, fmt.Errorf("%w: balance of card %s", ErrAmountOverflow, number)
+	}
+	account := r.state.accounts[card.AccountID]
+	if delta.Amount < 0 && account.Balance < -delta.Amount {
+		return nil, &InsufficientFundsError{
+			CardNumber: number,
+			Balance:    account.Money(),
+			Amount:     Money{Amount: -delta.Amount, Currency: delta.Currency},
+		}
+	}
+	if delta.Amount > 0 && account.Balance > math.MaxInt64-delta.Amount {
+		return nil, fmt.Errorf("%w: balance of card %s", ErrAmountOverflow, number)
+	}
+
+	account.Balance += delta.Amount
+	account.UpdatedAt = time.Now()
+	r.state.accounts[account.ID] = account
+	return r.withBalance(card), nil
+}
+
+func (r *MemoryCardRepository) Transfer(from, to string, debit, credit Money) (*Card, *Card, error) {
+	return transferBalances(r, from, to, debit, credit)
+}
+
+func (r *MemoryCardRepository) Delete(number, reason string) error {
+	defer r.lock()()
+
+	card, err := r.openCard(number)
+	if err != nil {
+		return err
+	}
+	if account := r.state.accounts[card.AccountID]; account.Balance != 0 {
+		return fmt.Errorf("%w: %v left on card %s", ErrBalanceRemaining, account.Money(), number)
+	}
+
+	now := time.Now()
+	card.Status, card.ClosedReason = StatusClosed, reason
+	card.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	card.UpdatedAt = now
+	r.state.cards[number] = card
+	return nil
+}
+
+func (r *MemoryCardRepository) Restore(number string) (*Card, error) {
+	defer r.lock()()
+
+	card, ok := r.state.cards[number]
+	if !ok {
+		return nil, ErrCardNotFound
+	}
+	if !card.DeletedAt.Valid || card.Status != StatusClosed {
+		return nil, ErrAccountNotClosed
+	}
+
+	card.Status, card.ClosedReason, card.DeletedAt = StatusActive, "", gorm.DeletedAt{}
+	card.UpdatedAt = time.Now()
+	r.state.cards[number] = card
+	return r.withBalance(card), nil
+}
+
+func (r *MemoryCardRepository) Deactivate(number, status string) error {
+	defer r.lock()()
+
+	card, err := r.openCard(number)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	card.Status = status
+	card.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	card.UpdatedAt = now
+	r.state.cards[number] = card
+	return nil
+}
+
+func (r *MemoryCardRepository) SetLockout(number string, failedPINAttempts int, lockedUntil *time.Time) error {
+	defer r.lock()()
+
+	card, ok := r.state.cards[number]
+	if !ok {
+		return ErrCardNotFound
+	}
+	card.FailedPINAttempts, card.LockedUntil = failedPINAttempts, lockedUntil
+	r.state.cards[number] = card
+	return nil
+}
+
+func (r *MemoryCardRepository) SetWithdrawalLimits(number string, perWithdrawal, daily *int64) error {
+	defer r.lock()()
+
+	card, err := r.openCard(number)
+	if err != nil {
+		return err
+	}
+	card.WithdrawalLimit, card.DailyWithdrawalLimit = perWithdrawal, daily
+	r.state.cards[number] = card
+	return nil
+}
+
+func (r *MemoryCardRepository) SetInterestRate(number string, rate *InterestRate) error {
+	defer r.lock()()
+
+	card, err := r.openCard(number)
+	if err != nil {
+		return err
+	}
+	card.InterestRate = rate
+	r.state.cards[number] = card
+	return nil
+}
+
+func (r *MemoryCardRepository) FindAccount(id uint) (*Account, error) {
+	defer r.lock()()
+
+	account, ok := r.state.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	return &account, nil
+}
+
+func (r *MemoryCardRepository) InterestDueCards(until time.Time) ([]Card, error) {
+	defer r.lock()()
+
+	var cards []Card
+	for _, card := range r.state.cards {
+		accruedUntil := r.state.accounts[card.AccountID].InterestAccruedUntil
+		if !card.DeletedAt.Valid && (accruedUntil == nil || accruedUntil.Before(until)) {
+			cards = append(cards, *r.withBalance(card))
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].AccountID < cards[j].AccountID })
+	return cards, nil
+}
+
+func (r *MemoryCardRepository) UpdateInterest(from, to *Account) error {
+	defer r.lock()()
+
+	stored, ok := r.state.accounts[from.ID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	accruedUntil := stored.InterestAccruedUntil
+	if (accruedUntil == nil) != (from.InterestAccruedUntil == nil) ||
+		accruedUntil != nil && !accruedUntil.Equal(*from.InterestAccruedUntil) {
+		return fmt.Errorf("%w: account %d", ErrInterestChanged, from.ID)
+	}
+
+	stored.AccruedInterest, stored.InterestAccruedUntil, stored.UpdatedAt = to.AccruedInterest, to.InterestAccruedUntil, time.Now()
+	r.state.accounts[from.ID] = stored
+	return nil
+}
+
+func (r *MemoryCardRepository) CreateCustomer(customer *Customer) error {
+	defer r.lock()()
+
+	r.state.lastCustomerID++
+	now := time.Now()
+	customer.ID, customer.CreatedAt, customer.UpdatedAt = r.state.lastCustomerID, now, now
+	stored := *customer
+	stored.Cards = nil
+	r.state.customers[customer.ID] = stored
+	return nil
+}
+
+func (r *MemoryCardRepository) FindCustomer(id uint) (*Customer, error) {
+	defer r.lock()()
+
+	customer, ok := r.state.customers[id]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	return &customer, nil
+}
+
+func (r *MemoryCardRepository) SetCustomer(number string, customerID uint) (*Card, error) {
+	defer r.lock()()
+
+	if _, ok := r.state.customers[customerID]; !ok {
+		return nil, ErrCustomerNotFound
+	}
+	card, err := r.openCard(number)
+	if err != nil {
+		return nil, err
+	}
+	card.CustomerID = &customerID
+	card.UpdatedAt = time.Now()
+	r.state.cards[number] = card
+	return r.withBalance(card), nil
+}
+
+func (r *MemoryCardRepository) CustomerCards(customerID uint) ([]Card, error) {
+	defer r.lock()()
+
+	var cards []Card
+	for _, card := range r.state.cards {
+		if card.CustomerID != nil && *card.CustomerID == customerID && !card.DeletedAt.Valid {
+			cards = append(cards, *r.withBalance(card))
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].ID < cards[j].ID })
+	return cards, nil
+}
+
+func (r *MemoryCardRepository) CreateScheduledTransfer(transfer *ScheduledTransfer) error {
+	defer r.lock()()
+
+	r.state.lastScheduleID++
+	now := time.Now()
+	transfer.ID, transfer.CreatedAt, transfer.UpdatedAt = r.state.lastScheduleID, now, now
+	if transfer.Status == "" {
+		transfer.Status = ScheduledActive
+	}
+	r.state.scheduled[transfer.ID] = *transfer
+	return nil
+}
+
+func (r *MemoryCardRepository) FindScheduledTransfer(id uint) (*ScheduledTransfer, error) {
+	defer r.lock()()
+
+	transfer, ok := r.state.scheduled[id]
+	if !ok {
+		return nil, ErrScheduledTransferNotFound
+	}
+	return &transfer, nil
+}
+
+func (r *MemoryCardRepository) ScheduledTransfers(senderNumber string) ([]ScheduledTransfer, error) {
+	return r.scheduledTransfers(func(transfer ScheduledTransfer) bool {
+		return transfer.SenderNumber == senderNumber
+	}, func(a, b ScheduledTransfer) bool {
+		return a.ID < b.ID
+	})
+}
+
+func (r *MemoryCardRepository) DueScheduledTransfers(now time.Time) ([]ScheduledTransfer, error) {
+	return r.scheduledTransfers(func(transfer ScheduledTransfer) bool {
+		return !transfer.NextRunAt.After(now)
+	}, func(a, b ScheduledTransfer) bool {
+		if !a.NextRunAt.Equal(b.NextRunAt) {
+			return a.NextRunAt.Before(b.NextRunAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// scheduledTransfers returns the active scheduled transfers matching match, sorted by less.
+func (r *MemoryCardRepository) scheduledTransfers(match func(ScheduledTransfer) bool, less func(a, b ScheduledTransfer) bool) ([]ScheduledTransfer, error) {
+	defer r.lock()()
+
+	var transfers []ScheduledTransfer
+	for _, transfer := range r.state.scheduled {
+		if transfer.Status == ScheduledActive && match(transfer) {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return less(transfers[i], transfers[j]) })
+	return transfers, nil
+}
+
+func (r *MemoryCardRepository) UpdateScheduledTransfer(from, to *ScheduledTransfer) error {
+	defer r.lock()()
+
+	stored, ok := r.state.scheduled[from.ID]
+	if !ok {
+		return ErrScheduledTransferNotFound
+	}
+	if stored.Status != from.Status || stored.Occurrence != from.Occurrence || stored.Attempts != from.Attempts {
+		return fmt.Errorf("%w: %d", ErrScheduleChanged, from.ID)
+	}
+
+	updated := *to
+	updated.ID, updated.CreatedAt, updated.UpdatedAt = stored.ID, stored.CreatedAt, time.Now()
+	r.state.scheduled[from.ID] = updated
+	return nil
+}
+
+func (r *MemoryCardRepository) MoveScheduledTransfers(from, to string) error {
+	defer r.lock()()
+
+	for id, transfer := range r.state.scheduled {
+		if transfer.Status != ScheduledActive {
+			continue
+		}
+		if transfer.SenderNumber == from {
+			transfer.SenderNumber = to
+		}
+		if transfer.RecipientNumber == from {
+			transfer.RecipientNumber = to
+		}
+		r.state.scheduled[id] = transfer
+	}
+	return nil
+}
+
+func (r *MemoryCardRepository) AddEntries(entries []Transaction) error {
+	defer r.lock()()
+
+	now := time.Now()
+	for i := range entries {
+		r.state.lastEntryID++
+		entries[i].ID, entries[i].UpdatedAt = r.state.lastEntryID, now
+		if entries[i].CreatedAt.IsZero() {
+			entries[i].CreatedAt = now
+		}
+		r.state.entries = append(r.state.entries, entries[i])
+	}
+	return nil
+}
+
+func (r *MemoryCardRepository) Entries(query EntryQuery) ([]Transaction, error) {
+	defer r.lock()()
+
+	var entries []Transaction
+	for _, entry := range r.state.entries {
+		if query.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if query.NewestFirst {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	}
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+	return entries, nil
+}
+
+func (q EntryQuery) matches(entry Transaction) bool {
+	return (q.CardNumber == "" || entry.CardNumber == q.CardNumber) &&
+		(q.Kind == "" || entry.Kind == q.Kind) &&
+		(q.Entry == "" || entry.Entry == q.Entry) &&
+		(q.AccountID == 0 || entry.AccountID != nil && *entry.AccountID == q.AccountID) &&
+		(q.Since.IsZero() || entry.CreatedAt.After(q.Since)) &&
+		(q.Until.IsZero() || entry.CreatedAt.Before(q.Until))
+}
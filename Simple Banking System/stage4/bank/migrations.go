@@ -0,0 +1,774 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SchemaMigrationsTableName is the table recording which migrations were applied to a database.
+const SchemaMigrationsTableName = "schema_migrations"
+
+// ErrSchemaTooNew is matched by SchemaTooNewError.
+var ErrSchemaTooNew = errors.New("database schema is newer than this program")
+
+// SchemaTooNewError is returned when a database was migrated by a newer version of the program,
+// which this one cannot safely use. It matches ErrSchemaTooNew.
+type SchemaTooNewError struct {
+	Version int
+	Latest  int
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("%v: version %d, this program knows up to %d", ErrSchemaTooNew, e.Version, e.Latest)
+}
+
+func (e *SchemaTooNewError) Is(target error) bool {
+	return target == ErrSchemaTooNew
+}
+
+// Migration is one numbered change of the database schema. Up applies it and Down reverts it;
+// Down is nil when the change cannot be reverted.
+//
+// Databases written before migrations were recorded have no schema_migrations table and start at
+// version 0, so every Up must also accept a database that already has its change, and leave it as
+// it is.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration is the record of an applied Migration.
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return SchemaMigrationsTableName
+}
+
+// MigrationStatus tells whether a migration has been applied to a database.
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is nil while the migration is pending.
+	AppliedAt *time.Time
+}
+
+// cardsV1 and transactionsV1 are the tables as they were first created. Every later migration
+// that changes a table works on its own snapshot of it, named after the migration, so that it
+// keeps doing what it did when it was released however the models change afterwards.
+type cardsV1 struct {
+	gorm.Model
+	Number  string `gorm:"unique;not null"`
+	PIN     string
+	Balance int64 `gorm:"default:0"`
+}
+
+func (cardsV1) TableName() string {
+	return TableName
+}
+
+type transactionsV1 struct {
+	gorm.Model
+	Reference    string `gorm:"index;not null"`
+	CardNumber   string `gorm:"index;not null"`
+	Counterparty string `gorm:"not null"`
+	Kind         string `gorm:"not null"`
+	Entry        string `gorm:"not null"`
+	Amount       int64  `gorm:"not null"`
+}
+
+func (transactionsV1) TableName() string {
+	return TransactionsTableName
+}
+
+type cardsV4 struct {
+	cardsV1
+	FailedPINAttempts int `gorm:"default:0"`
+	LockedUntil       *time.Time
+}
+
+// cardsV5 keeps the balance in minor units next to the whole-unit balance column.
+type cardsV5 struct {
+	cardsV4
+	MinorBalance int64  `gorm:"not null;default:0"`
+	Currency     string `gorm:"not null;default:USD"`
+}
+
+type transactionsV5 struct {
+	transactionsV1
+	Currency string `gorm:"not null;default:USD"`
+}
+
+type transactionsV6 struct {
+	transactionsV5
+	Rate string
+}
+
+type cardsV7 struct {
+	cardsV5
+	WithdrawalLimit      *int64
+	DailyWithdrawalLimit *int64
+}
+
+type cardsV8 struct {
+	cardsV7
+	Status       string `gorm:"not null;default:active"`
+	ClosedReason string
+}
+
+type cardsV9 struct {
+	cardsV8
+	Product string `gorm:"not null;default:classic"`
+}
+
+type customersV10 struct {
+	gorm.Model
+	Name  string `gorm:"not null"`
+	Email string
+	Phone string
+}
+
+func (customersV10) TableName() string {
+	return CustomersTableName
+}
+
+type cardsV10 struct {
+	cardsV9
+	CustomerID *uint `gorm:"index"`
+}
+
+type accountsV11 struct {
+	gorm.Model
+	Balance  int64  `gorm:"not null;default:0"`
+	Currency string `gorm:"not null;default:USD"`
+}
+
+func (accountsV11) TableName() string {
+	return AccountsTableName
+}
+
+// cardsV11 has the balance in minor units moved to its account. The whole-unit balance column
+// stays, in step with the account.
+type cardsV11 struct {
+	cardsV10
+	AccountID uint `gorm:"index"`
+}
+
+type transactionsV11 struct {
+	transactionsV6
+	AccountID *uint `gorm:"index"`
+}
+
+type scheduledTransfersV12 struct {
+	gorm.Model
+	SenderNumber    string `gorm:"index;not null"`
+	RecipientNumber string `gorm:"not null"`
+	Amount          int64  `gorm:"not null"`
+	Currency        string `gorm:"not null;default:USD"`
+	Schedule        string `gorm:"not null"`
+	StartAt         time.Time
+	Occurrence      int       `gorm:"not null;default:0"`
+	NextRunAt       time.Time `gorm:"index"`
+	Attempts        int       `gorm:"not null;default:0"`
+	Status          string    `gorm:"not null;default:active"`
+	LastRunAt       *time.Time
+	LastError       string
+}
+
+func (scheduledTransfersV12) TableName() string {
+	return ScheduledTransfersTableName
+}
+
+type transactionsV12 struct {
+	transactionsV11
+	ScheduledFor *time.Time
+}
+
+// cardsV13 keeps the interest rate in basis points.
+type cardsV13 struct {
+	cardsV11
+	InterestRate *int
+}
+
+type accountsV13 struct {
+	accountsV11
+	AccruedInterest      int64 `gorm:"not null;default:0"`
+	InterestAccruedUntil *time.Time
+}
+
+// Migrations lists every schema change in the order it is applied. Append new migrations at the
+// end and never change one that has been released.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create cards",
+		Up:      createTable(&cardsV1{}),
+		Down:    dropTable(&cardsV1{}),
+	},
+	{
+		Version: 2,
+		Name:    "create transactions",
+		Up:      createTable(&transactionsV1{}),
+		Down:    dropTable(&transactionsV1{}),
+	},
+	{
+		Version: 3,
+		Name:    "hash PINs",
+		Up:      hashPlaintextPINs,
+	},
+	{
+		Version: 4,
+		Name:    "add PIN lockout",
+		Up:      addColumns(&cardsV4{}, "FailedPINAttempts", "LockedUntil"),
+		Down:    dropColumns(&cardsV4{}, "FailedPINAttempts", "LockedUntil"),
+	},
+	{
+		Version: 5,
+		Name:    "store amounts in minor units",
+		Up:      convertToMinorUnits,
+		Down:    convertToWholeUnits,
+	},
+	{
+		Version: 6,
+		Name:    "add transaction rate",
+		Up:      addColumns(&transactionsV6{}, "Rate"),
+		Down:    dropColumns(&transactionsV6{}, "Rate"),
+	},
+	{
+		Version: 7,
+		Name:    "add withdrawal limits",
+		Up:      addColumns(&cardsV7{}, "WithdrawalLimit", "DailyWithdrawalLimit"),
+		Down:    dropColumns(&cardsV7{}, "WithdrawalLimit", "DailyWithdrawalLimit"),
+	},
+	{
+		Version: 8,
+		Name:    "add card status",
+		Up:      addCardStatus,
+		Down:    dropColumns(&cardsV8{}, "Status", "ClosedReason"),
+	},
+	{
+		Version: 9,
+		Name:    "add card product",
+		Up:      addColumns(&cardsV9{}, "Product"),
+		Down:    dropColumns(&cardsV9{}, "Product"),
+	},
+	{
+		Version: 10,
+		Name:    "add customers",
+		Up:      addCustomers,
+		Down:    dropCustomers,
+	},
+	{
+		Version: 11,
+		Name:    "add accounts",
+		Up:      addAccounts,
+		Down:    dropAccounts,
+	},
+	{
+		Version: 12,
+		Name:    "add scheduled transfers",
+		Up:      addScheduledTransfers,
+		Down:    dropScheduledTransfers,
+	},
+	{
+		Version: 13,
+		Name:    "add interest",
+		Up:      addInterest,
+		Down:    dropInterest,
+	},
+	{
+		Version: 14,
+		Name:    "store ledger times in UTC",
+		Up:      ledgerTimesToUTC,
+		Down:    keepLedgerTimesInUTC,
+	},
+}
+
+// LatestSchemaVersion returns the version of the last known migration.
+func LatestSchemaVersion() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the last migration applied to db, 0 if none was.
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+
+	var version int
+	result := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version)
+	if result.Error != nil {
+		return 0, fmt.Errorf("cannot read schema version: %v", result.Error)
+	}
+	return version, nil
+}
+
+// MigrateUp applies the pending migrations to db. It refuses to touch a database whose schema is
+// newer than the program.
+func MigrateUp(db *gorm.DB) error {
+	version, err := checkSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if err := createTable(&SchemaMigration{})(db); err != nil {
+		return fmt.Errorf("failed to create %s table: %v", SchemaMigrationsTableName, err)
+	}
+
+	for _, migration := range Migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Another process may have applied the migration since the version was read.
+			var applied int64
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied != 0 {
+				return nil
+			}
+
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the last steps applied migrations of db.
+func MigrateDown(db *gorm.DB, steps int) error {
+	version, err := checkSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	var reverted []Migration
+	for i := len(Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if Migrations[i].Version > version {
+			continue
+		}
+		// Nothing is reverted unless all the steps can be.
+		if Migrations[i].Down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be reverted", Migrations[i].Version, Migrations[i].Name)
+		}
+		reverted = append(reverted, Migrations[i])
+	}
+
+	for _, migration := range reverted {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrationStatuses returns the status of every known migration of db.
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	var applied []SchemaMigration
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		if err := db.Find(&applied).Error; err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", SchemaMigrationsTableName, err)
+		}
+	}
+	appliedAt := make(map[int]time.Time, len(applied))
+	for _, migration := range applied {
+		appliedAt[migration.Version] = migration.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, len(Migrations))
+	for i, migration := range Migrations {
+		statuses[i].Migration = migration
+		if at, ok := appliedAt[migration.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// checkSchemaVersion returns the schema version of db, or SchemaTooNewError if the program does
+// not know it.
+func checkSchemaVersion(db *gorm.DB) (int, error) {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return 0, &SchemaTooNewError{Version: version, Latest: latest}
+	}
+	return version, nil
+}
+
+func createTable(model any) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(model) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(model)
+	}
+}
+
+func dropTable(model any) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(model)
+	}
+}
+
+func addColumns(model any, fields ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, field := range fields {
+			if tx.Migrator().HasColumn(model, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(model, field); err != nil {
+				return fmt.Errorf("failed to add %s column: %v", field, err)
+			}
+		}
+		return nil
+	}
+}
+
+func dropColumns(model any, fields ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, field := range fields {
+			if err := tx.Migrator().DropColumn(model, field); err != nil {
+				return fmt.Errorf("failed to drop %s column: %v", field, err)
+			}
+		}
+		return nil
+	}
+}
+
+func createIndexes(model any, fields ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, field := range fields {
+			if tx.Migrator().HasIndex(model, field) {
+				continue
+			}
+			if err := tx.Migrator().CreateIndex(model, field); err != nil {
+				return fmt.Errorf("failed to index %s column: %v", field, err)
+			}
+		}
+		return nil
+	}
+}
+
+// addCardStatus adds the status and closure reason columns, marking the cards that were
+// soft-deleted before closures were recorded as closed.
+func addCardStatus(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&cardsV8{}, "Status") {
+		return nil
+	}
+	if err := addColumns(&cardsV8{}, "Status", "ClosedReason")(tx); err != nil {
+		return err
+	}
+
+	result := tx.Unscoped().Model(&cardsV8{}).
+		Where("deleted_at IS NOT NULL").
+		Update("status", StatusClosed)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark closed cards: %v", result.Error)
+	}
+	return nil
+}
+
+// addCustomers creates the customers table and the indexed column linking cards to their
+// customer.
+func addCustomers(tx *gorm.DB) error {
+	if err := createTable(&customersV10{})(tx); err != nil {
+		return err
+	}
+	if err := addColumns(&cardsV10{}, "CustomerID")(tx); err != nil {
+		return err
+	}
+	if tx.Migrator().HasIndex(&cardsV10{}, "CustomerID") {
+		return nil
+	}
+	if err := tx.Migrator().CreateIndex(&cardsV10{}, "CustomerID"); err != nil {
+		return fmt.Errorf("failed to index customer_id column: %v", err)
+	}
+	return nil
+}
+
+// dropCustomers reverts addCustomers. The index goes first, since SQLite cannot drop an indexed
+// column, and the index on deleted_at, lost when SQLite copies the table to drop the column, is
+// created again.
+func dropCustomers(tx *gorm.DB) error {
+	if err := tx.Migrator().DropIndex(&cardsV10{}, "CustomerID"); err != nil {
+		return fmt.Errorf("failed to drop customer_id index: %v", err)
+	}
+	if err := dropColumns(&cardsV10{}, "CustomerID")(tx); err != nil {
+		return err
+	}
+	if !tx.Migrator().HasIndex(&cardsV1{}, "DeletedAt") {
+		if err := tx.Migrator().CreateIndex(&cardsV1{}, "DeletedAt"); err != nil {
+			return fmt.Errorf("failed to index deleted_at column: %v", err)
+		}
+	}
+	return dropTable(&customersV10{})(tx)
+}
+
+// addAccounts moves the balance of every card, in minor units, to an account of its own, and
+// links the cards and their ledger entries to it. The whole-unit balance column of the cards
+// stays as it is.
+func addAccounts(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&cardsV5{}, "MinorBalance") {
+		return nil
+	}
+	if err := createTable(&accountsV11{})(tx); err != nil {
+		return err
+	}
+	if err := addColumns(&cardsV11{}, "AccountID")(tx); err != nil {
+		return err
+	}
+	if err := addColumns(&transactionsV11{}, "AccountID")(tx); err != nil {
+		return err
+	}
+
+	var cards []struct {
+		ID           uint
+		MinorBalance int64
+		Currency     string
+		CreatedAt    time.Time
+	}
+	if err := tx.Table(TableName).Select("id, minor_balance, currency, created_at").Order("id").Find(&cards).Error; err != nil {
+		return fmt.Errorf("failed to read card balances: %v", err)
+	}
+	for _, card := range cards {
+		account := accountsV11{Balance: card.MinorBalance, Currency: card.Currency}
+		account.CreatedAt = card.CreatedAt
+		if err := tx.Create(&account).Error; err != nil {
+			return fmt.Errorf("failed to create account of card %d: %v", card.ID, err)
+		}
+		if err := tx.Table(TableName).Where("id = ?", card.ID).Update("account_id", account.ID).Error; err != nil {
+			return fmt.Errorf("failed to link card %d to its account: %v", card.ID, err)
+		}
+	}
+
+	result := tx.Exec("UPDATE " + TransactionsTableName + " SET account_id = (SELECT account_id FROM " + TableName +
+		" WHERE " + TableName + ".number = " + TransactionsTableName + ".card_number)")
+	if result.Error != nil {
+		return fmt.Errorf("failed to link ledger entries to their account: %v", result.Error)
+	}
+
+	if err := dropColumns(&cardsV5{}, "MinorBalance")(tx); err != nil {
+		return err
+	}
+
+	// SQLite drops a column by copying the table, which loses its indexes, so they are created
+	// last, each through the snapshot that declares it.
+	if err := restoreCardIndexes(tx); err != nil {
+		return err
+	}
+	if err := createIndexes(&cardsV11{}, "AccountID")(tx); err != nil {
+		return err
+	}
+	return createIndexes(&transactionsV11{}, "AccountID")(tx)
+}
+
+// dropAccounts reverts addAccounts. The balance of an account goes back to its latest card; the
+// cards it replaced are left with none. The indexes of cards and transactions lost by dropping a
+// column on SQLite are created again.
+func dropAccounts(tx *gorm.DB) error {
+	if err := addColumns(&cardsV5{}, "MinorBalance")(tx); err != nil {
+		return err
+	}
+	result := tx.Exec("UPDATE " + TableName + " SET minor_balance = COALESCE((SELECT balance FROM " + AccountsTableName +
+		" WHERE " + AccountsTableName + ".id = " + TableName + ".account_id AND " + TableName + ".id = " +
+		"(SELECT MAX(latest.id) FROM " + TableName + " latest WHERE latest.account_id = " + TableName + ".account_id)), 0)")
+	if result.Error != nil {
+		return fmt.Errorf("failed to copy account balances to cards: %v", result.Error)
+	}
+	for currency := range currencyExponents {
+		unit, err := currencyUnit(currency)
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&cardsV5{}).
+			Where("currency = ?", currency).
+			Update("balance", gorm.Expr("minor_balance / ?", unit))
+		if result.Error != nil {
+			return fmt.Errorf("failed to convert balances to whole units: %v", result.Error)
+		}
+	}
+
+	for _, model := range []any{&cardsV11{}, &transactionsV11{}} {
+		if err := tx.Migrator().DropIndex(model, "AccountID"); err != nil {
+			return fmt.Errorf("failed to drop account_id index: %v", err)
+		}
+		if err := dropColumns(model, "AccountID")(tx); err != nil {
+			return err
+		}
+	}
+	if err := restoreCardIndexes(tx); err != nil {
+		return err
+	}
+	if err := createIndexes(&transactionsV1{}, "DeletedAt", "Reference", "CardNumber")(tx); err != nil {
+		return err
+	}
+	return dropTable(&accountsV11{})(tx)
+}
+
+// addScheduledTransfers creates the scheduled transfers table and the column recording which run
+// of a scheduled transfer made a ledger entry.
+func addScheduledTransfers(tx *gorm.DB) error {
+	if err := createTable(&scheduledTransfersV12{})(tx); err != nil {
+		return err
+	}
+	return addColumns(&transactionsV12{}, "ScheduledFor")(tx)
+}
+
+// dropScheduledTransfers reverts addScheduledTransfers, creating again the indexes of transactions
+// lost by dropping a column on SQLite.
+func dropScheduledTransfers(tx *gorm.DB) error {
+	if err := dropColumns(&transactionsV12{}, "ScheduledFor")(tx); err != nil {
+		return err
+	}
+	if err := createIndexes(&transactionsV1{}, "DeletedAt", "Reference", "CardNumber")(tx); err != nil {
+		return err
+	}
+	if err := createIndexes(&transactionsV11{}, "AccountID")(tx); err != nil {
+		return err
+	}
+	return dropTable(&scheduledTransfersV12{})(tx)
+}
+
+// restoreCardIndexes creates the indexes of the cards table up to cardsV10 that are missing.
+func restoreCardIndexes(tx *gorm.DB) error {
+	if err := createIndexes(&cardsV1{}, "DeletedAt")(tx); err != nil {
+		return err
+	}
+	return createIndexes(&cardsV10{}, "CustomerID")(tx)
+}
+
+// convertToMinorUnits adds the currency column to the tables written before amounts carried a
+// currency, and converts their whole-unit amounts into minor units of DefaultCurrency. Cards get
+// the minor units in a new column and keep their whole-unit balance column.
+func convertToMinorUnits(tx *gorm.DB) error {
+	unit, err := currencyUnit(DefaultCurrency)
+	if err != nil {
+		return err
+	}
+
+	if !tx.Migrator().HasColumn(&cardsV5{}, "Currency") {
+		if err := addColumns(&cardsV5{}, "MinorBalance", "Currency")(tx); err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&cardsV5{}).
+			Where("1 = 1").
+			Updates(map[string]any{"minor_balance": gorm.Expr("balance * ?", unit), "currency": DefaultCurrency})
+		if result.Error != nil {
+			return fmt.Errorf("failed to convert balances to minor units: %v", result.Error)
+		}
+	}
+
+	if !tx.Migrator().HasColumn(&transactionsV5{}, "Currency") {
+		if err := addColumns(&transactionsV5{}, "Currency")(tx); err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&transactionsV5{}).
+			Where("1 = 1").
+			Updates(map[string]any{"amount": gorm.Expr("amount * ?", unit), "currency": DefaultCurrency})
+		if result.Error != nil {
+			return fmt.Errorf("failed to convert amounts to minor units: %v", result.Error)
+		}
+	}
+	return nil
+}
+
+// convertToWholeUnits reverts convertToMinorUnits. Fractions of a unit are truncated and the
+// currency of the amounts is lost.
+func convertToWholeUnits(tx *gorm.DB) error {
+	for currency := range currencyExponents {
+		unit, err := currencyUnit(currency)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&cardsV5{}).
+			Where("currency = ?", currency).
+			Update("balance", gorm.Expr("minor_balance / ?", unit))
+		if result.Error != nil {
+			return fmt.Errorf("failed to convert balances to whole units: %v", result.Error)
+		}
+		result = tx.Unscoped().Model(&transactionsV5{}).
+			Where("currency = ?", currency).
+			Update("amount", gorm.Expr("amount / ?", unit))
+		if result.Error != nil {
+			return fmt.Errorf("failed to convert amounts to whole units: %v", result.Error)
+		}
+	}
+
+	if err := dropColumns(&cardsV5{}, "MinorBalance", "Currency")(tx); err != nil {
+		return err
+	}
+	return dropColumns(&transactionsV5{}, "Currency")(tx)
+}
+
+// addInterest adds the interest rates of the cards and the interest accrued by the accounts.
+func addInterest(tx *gorm.DB) error {
+	if err := addColumns(&cardsV13{}, "InterestRate")(tx); err != nil {
+		return err
+	}
+	return addColumns(&accountsV13{}, "AccruedInterest", "InterestAccruedUntil")(tx)
+}
+
+// dropInterest drops the interest columns, restoring the indexes that SQLite loses when it
+// rebuilds the tables.
+func dropInterest(tx *gorm.DB) error {
+	if err := dropColumns(&accountsV13{}, "AccruedInterest", "InterestAccruedUntil")(tx); err != nil {
+		return err
+	}
+	if err := createIndexes(&accountsV11{}, "DeletedAt")(tx); err != nil {
+		return err
+	}
+	if err := dropColumns(&cardsV13{}, "InterestRate")(tx); err != nil {
+		return err
+	}
+	if err := restoreCardIndexes(tx); err != nil {
+		return err
+	}
+	return createIndexes(&cardsV11{}, "AccountID")(tx)
+}
+
+// ledgerTimesToUTC converts the creation times of the ledger entries that SQLite stored in the
+// local time zone to UTC, so that they compare as text in the order of the times. SQLite keeps
+// them to the millisecond. PostgreSQL stores them as timestamptz, which already compare as
+// instants, so they are left alone there.
+func ledgerTimesToUTC(tx *gorm.DB) error {
+	switch name := tx.Dialector.Name(); name {
+	case "sqlite":
+	case "postgres":
+		return nil
+	default:
+		return fmt.Errorf("cannot convert ledger times stored by %s", name)
+	}
+	result := tx.Exec("UPDATE " + TransactionsTableName + " SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at) " +
+		"WHERE created_at NOT LIKE '%+00:00'")
+	if result.Error != nil {
+		return fmt.Errorf("failed to convert ledger times to UTC: %v", result.Error)
+	}
+	return nil
+}
+
+// keepLedgerTimesInUTC reverts ledgerTimesToUTC by doing nothing: times in UTC read the same.
+func keepLedgerTimesInUTC(tx *gorm.DB) error {
+	return nil
+}
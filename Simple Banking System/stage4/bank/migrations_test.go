@@ -0,0 +1,191 @@
+package bank
+
+import (
+	"errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(filepath.Join(t.TempDir(), "card.db"))))
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up failed: %v", err)
+	}
+	if version, _ := SchemaVersion(db); version != LatestSchemaVersion() {
+		t.Fatalf("schema version is %d after migrating up, want %d", version, LatestSchemaVersion())
+	}
+
+	cards, err := NewGormCardRepository(db)
+	if err != nil {
+		t.Fatalf("cannot open migrated database: %v", err)
+	}
+	createTestCard(t, cards, "4000000000000002", 1250)
+
+	reversible := 0
+	for i := len(Migrations) - 1; i >= 0 && Migrations[i].Down != nil; i-- {
+		reversible++
+	}
+	if err := MigrateDown(db, reversible); err != nil {
+		t.Fatalf("migrating down failed: %v", err)
+	}
+	if err := MigrateDown(db, 1); err == nil {
+		t.Errorf("reverting an irreversible migration succeeded")
+	}
+
+	var balance int64
+	if err := db.Table(TableName).Select("balance").Where("number = ?", "4000000000000002").Scan(&balance).Error; err != nil || balance != 12 {
+		t.Errorf("balance after migrating down is %d, %v, want 12 whole units", balance, err)
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up again failed: %v", err)
+	}
+	if card, err := cards.FindByNumber("4000000000000002"); err != nil || card.Money() != usd(1200) {
+		t.Errorf("card after migrating up again is %+v, %v, want a balance of 12.00 USD", card, err)
+	}
+	for _, column := range []string{"Currency", "Status", "WithdrawalLimit", "Product", "CustomerID", "AccountID", "InterestRate"} {
+		if !db.Migrator().HasColumn(&Card{}, column) {
+			t.Errorf("cards table lacks the %s column after migrating up again", column)
+		}
+	}
+	if !db.Migrator().HasColumn(&Account{}, "InterestAccruedUntil") {
+		t.Errorf("accounts table lacks the InterestAccruedUntil column after migrating up again")
+	}
+	if !db.Migrator().HasTable(&ScheduledTransfer{}) {
+		t.Errorf("scheduled transfers table is missing after migrating up again")
+	}
+}
+
+func TestMigrateDownKeepsIndexes(t *testing.T) {
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(filepath.Join(t.TempDir(), "card.db"))))
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up failed: %v", err)
+	}
+	// Reverting the migrations from the customers on drops columns, which copies the cards and
+	// transactions tables on SQLite.
+	for version := LatestSchemaVersion() - 1; version >= 9; version-- {
+		if err := MigrateDown(db, 1); err != nil {
+			t.Fatalf("migrating down to version %d failed: %v", version, err)
+		}
+		if !db.Migrator().HasIndex(&cardsV1{}, "DeletedAt") {
+			t.Errorf("cards table lost its deleted_at index at version %d", version)
+		}
+		for _, field := range []string{"DeletedAt", "Reference", "CardNumber"} {
+			if !db.Migrator().HasIndex(&transactionsV1{}, field) {
+				t.Errorf("transactions table lost its %s index at version %d", field, version)
+			}
+		}
+	}
+}
+
+func TestMigrateUpAdoptsDatabasesWithoutVersion(t *testing.T) {
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(filepath.Join(t.TempDir(), "card.db"))))
+
+	// The table as the first version of the program left it, with a plaintext PIN and a balance
+	// in whole units.
+	if err := db.Migrator().CreateTable(&cardsV1{}); err != nil {
+		t.Fatalf("cannot create legacy table: %v", err)
+	}
+	if err := db.Create(&cardsV1{Number: "4000000000000002", PIN: "1234", Balance: 12}).Error; err != nil {
+		t.Fatalf("cannot create legacy card: %v", err)
+	}
+
+	cards, err := NewGormCardRepository(db)
+	if err != nil {
+		t.Fatalf("cannot open legacy database: %v", err)
+	}
+
+	card, err := cards.FindByNumber("4000000000000002")
+	if err != nil {
+		t.Fatalf("legacy card is gone: %v", err)
+	}
+	if card.Money() != (Money{Amount: 1200, Currency: DefaultCurrency}) {
+		t.Errorf("legacy balance is %v, want 12.00 %s", card.Money(), DefaultCurrency)
+	}
+	if card.Status != StatusActive || !VerifyPIN("1234", card.PIN) || card.PIN == "1234" {
+		t.Errorf("legacy card has status %q and PIN %q", card.Status, card.PIN)
+	}
+}
+
+func TestAccountsMigrationKeepsBalances(t *testing.T) {
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(filepath.Join(t.TempDir(), "card.db"))))
+	cards, err := NewGormCardRepository(db)
+	if err != nil {
+		t.Fatalf("cannot open database: %v", err)
+	}
+	card := createTestCard(t, cards, "4000000000000002", 250)
+
+	if err := MigrateDown(db, LatestSchemaVersion()-10); err != nil {
+		t.Fatalf("reverting the accounts failed: %v", err)
+	}
+	var balances struct{ Balance, MinorBalance int64 }
+	err = db.Model(&cardsV10{}).Select("balance, minor_balance").Where("number = ?", card.Number).Scan(&balances).Error
+	if err != nil || balances.MinorBalance != 250 || balances.Balance != 2 {
+		t.Errorf("balances are %+v, %v on the card without accounts, want 250 minor and 2 whole units", balances, err)
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up again failed: %v", err)
+	}
+	if card, err := cards.FindByNumber(card.Number); err != nil || card.Balance != 250 || card.WholeBalance != 2 || card.AccountID == 0 {
+		t.Errorf("card was found as %+v, %v, want 250 on an account", card, err)
+	}
+	if db.Migrator().HasColumn(&cardsV5{}, "MinorBalance") {
+		t.Errorf("cards table keeps its minor_balance column")
+	}
+}
+
+func TestNewerSchemaIsRefused(t *testing.T) {
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(filepath.Join(t.TempDir(), "card.db"))))
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up failed: %v", err)
+	}
+	future := SchemaMigration{Version: LatestSchemaVersion() + 1, Name: "from the future"}
+	if err := db.Create(&future).Error; err != nil {
+		t.Fatalf("cannot record future migration: %v", err)
+	}
+
+	if _, err := NewGormCardRepository(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("opening a newer database failed with %v, want %v", err, ErrSchemaTooNew)
+	}
+	if err := MigrateDown(db, 1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("migrating a newer database down failed with %v, want %v", err, ErrSchemaTooNew)
+	}
+}
+
+func TestLedgerTimesMigrationUsesUTC(t *testing.T) {
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(filepath.Join(t.TempDir(), "card.db"))))
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up failed: %v", err)
+	}
+	if err := MigrateDown(db, 1); err != nil {
+		t.Fatalf("migrating down failed: %v", err)
+	}
+
+	// An entry stored with the offset of a time zone two hours ahead, at 23:00 on September 30 in
+	// UTC.
+	createdAt := time.Date(2030, time.October, 1, 1, 0, 0, 123456789, time.FixedZone("UTC+2", 2*60*60))
+	entry := Transaction{Model: gorm.Model{CreatedAt: createdAt}, Reference: "r", CardNumber: "4000000000000002",
+		Counterparty: ExternalAccount, Kind: KindIncome, Entry: EntryCredit, Amount: 1, Currency: DefaultCurrency}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatalf("cannot create entry: %v", err)
+	}
+
+	cards, err := NewGormCardRepository(db)
+	if err != nil {
+		t.Fatalf("migrating up again failed: %v", err)
+	}
+	october := time.Date(2030, time.October, 1, 0, 0, 0, 0, time.UTC)
+	if got, err := cards.Entries(EntryQuery{Until: october}); err != nil || len(got) != 1 || !got[0].CreatedAt.Equal(createdAt.Truncate(time.Millisecond)) {
+		t.Errorf("entries of September are %+v, %v, want the entry created at %v", got, err, createdAt)
+	}
+	if got, err := cards.Entries(EntryQuery{Since: october.Add(-time.Nanosecond)}); err != nil || len(got) != 0 {
+		t.Errorf("entries of October are %+v, %v, want none", got, err)
+	}
+}
@@ -0,0 +1,176 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of cards that do not choose one.
+const DefaultCurrency = "USD"
+
+// currencyExponents maps the supported ISO 4217 currency codes to their number of minor units.
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KWD": 3,
+	"SEK": 2,
+	"USD": 2,
+}
+
+// Money failures
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidMoney     = errors.New("invalid amount of money")
+	ErrAmountOverflow   = errors.New("amount out of range")
+)
+
+// Money is an amount in the minor units (e.g. cents) of an ISO 4217 currency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// CurrencyExponent returns the number of minor units of currency.
+func CurrencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exponent, nil
+}
+
+// currencyUnit returns the number of minor units in a whole unit of currency, e.g. 100 for USD.
+func currencyUnit(currency string) (int64, error) {
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Pow10(exponent)), nil
+}
+
+// ParseMoney parses a decimal amount such as "12", "12.5" or "-0.75" in currency. The amount
+// may not have more fractional digits than the currency has minor units.
+func ParseMoney(s, currency string) (Money, error) {
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || hasFraction && fraction == "" || len(fraction) > exponent ||
+		!isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, err := strconv.ParseInt("0"+whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrAmountOverflow, s)
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, char := range s {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Add returns m + other, failing on differing currencies and on overflow.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	if other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount ||
+		other.Amount < 0 && m.Amount < math.MinInt64-other.Amount {
+		return Money{}, fmt.Errorf("%w: %v + %v", ErrAmountOverflow, m, other)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other, failing on differing currencies and on overflow.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: %v - %v", ErrAmountOverflow, m, other)
+	}
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Rat returns m in major units of its currency, e.g. 12.5 for 12.50 USD.
+func (m Money) Rat() (*big.Rat, error) {
+	exponent, err := CurrencyExponent(m.Currency)
+	if err != nil {
+		return nil, err
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+	return new(big.Rat).SetFrac(big.NewInt(m.Amount), scale), nil
+}
+
+// IsPositive reports whether m is greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Decimal formats m as a decimal number with all its minor units, e.g. "12.50".
+func (m Money) Decimal() string {
+	exponent, err := CurrencyExponent(m.Currency)
+	if err != nil {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	digits := strconv.FormatUint(absInt64(m.Amount), 10)
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	if exponent == 0 {
+		return sign + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// WholeUnits returns m in whole units of its currency, rounded toward zero.
+func (m Money) WholeUnits() int64 {
+	unit, err := currencyUnit(m.Currency)
+	if err != nil {
+		return m.Amount
+	}
+	return m.Amount / unit
+}
+
+// String formats m as its decimal amount followed by the currency code, e.g. "12.50 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
@@ -0,0 +1,161 @@
+package bank
+
+import (
+	"errors"
+	"gorm.io/driver/sqlite"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		currency string
+		want     int64
+	}{
+		{"12", "USD", 1200},
+		{"12.5", "USD", 1250},
+		{" 12.50 ", "USD", 1250},
+		{"-0.75", "USD", -75},
+		{"+3", "EUR", 300},
+		{".5", "USD", 50},
+		{"1.234", "KWD", 1234},
+		{"150", "JPY", 150},
+		{"92233720368547758.07", "USD", math.MaxInt64},
+	} {
+		if money, err := ParseMoney(test.input, test.currency); err != nil || money != (Money{Amount: test.want, Currency: test.currency}) {
+			t.Errorf("ParseMoney(%q, %s) = %v, %v, want %d", test.input, test.currency, money, err, test.want)
+		}
+	}
+	for _, test := range []struct {
+		input    string
+		currency string
+		want     error
+	}{
+		{"12.345", "USD", ErrInvalidMoney},
+		{"1.5", "JPY", ErrInvalidMoney},
+		{"1.", "USD", ErrInvalidMoney},
+		{"", "USD", ErrInvalidMoney},
+		{"1e3", "USD", ErrInvalidMoney},
+		{"1,50", "USD", ErrInvalidMoney},
+		{"--1", "USD", ErrInvalidMoney},
+		{"92233720368547758.08", "USD", ErrAmountOverflow},
+		{"1", "XXX", ErrUnknownCurrency},
+	} {
+		if money, err := ParseMoney(test.input, test.currency); !errors.Is(err, test.want) {
+			t.Errorf("ParseMoney(%q, %s) = %v, %v, want %v", test.input, test.currency, money, err, test.want)
+		}
+	}
+}
+
+func TestMoneyFormatting(t *testing.T) {
+	for _, test := range []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 1250, Currency: "USD"}, "12.50 USD"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05 USD"},
+		{Money{Amount: -75, Currency: "EUR"}, "-0.75 EUR"},
+		{Money{Amount: 0, Currency: "KWD"}, "0.000 KWD"},
+		{Money{Amount: 150, Currency: "JPY"}, "150 JPY"},
+		{Money{Amount: math.MinInt64, Currency: "USD"}, "-92233720368547758.08 USD"},
+	} {
+		if got := test.money.String(); got != test.want {
+			t.Errorf("%#v is formatted as %q, want %q", test.money, got, test.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	if sum, err := usd(150).Add(usd(-200)); err != nil || sum != usd(-50) {
+		t.Errorf("1.50 + -2.00 = %v, %v, want -0.50", sum, err)
+	}
+	if difference, err := usd(150).Sub(usd(200)); err != nil || difference != usd(-50) {
+		t.Errorf("1.50 - 2.00 = %v, %v, want -0.50", difference, err)
+	}
+	if _, err := usd(1).Add(Money{Amount: 1, Currency: "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("adding EUR to USD failed with %v, want %v", err, ErrCurrencyMismatch)
+	}
+	for _, test := range []struct {
+		name string
+		op   func() (Money, error)
+	}{
+		{"max + 1", func() (Money, error) { return usd(math.MaxInt64).Add(usd(1)) }},
+		{"min + -1", func() (Money, error) { return usd(math.MinInt64).Add(usd(-1)) }},
+		{"min - 1", func() (Money, error) { return usd(math.MinInt64).Sub(usd(1)) }},
+		{"0 - min", func() (Money, error) { return usd(0).Sub(usd(math.MinInt64)) }},
+	} {
+		if result, err := test.op(); !errors.Is(err, ErrAmountOverflow) {
+			t.Errorf("%s = %v, %v, want %v", test.name, result, err, ErrAmountOverflow)
+		}
+	}
+}
+
+func TestMoneyRat(t *testing.T) {
+	if value, err := (Money{Amount: 1250, Currency: "KWD"}).Rat(); err != nil || value.RatString() != "5/4" {
+		t.Errorf("1.250 KWD is %v, %v in major units, want 5/4", value, err)
+	}
+	if value, err := (Money{Amount: -150, Currency: "JPY"}).Rat(); err != nil || value.RatString() != "-150" {
+		t.Errorf("-150 JPY is %v, %v in major units, want -150", value, err)
+	}
+}
+
+func TestMoneyWholeUnits(t *testing.T) {
+	for _, test := range []struct {
+		money Money
+		want  int64
+	}{
+		{Money{Amount: 1250, Currency: "USD"}, 12},
+		{Money{Amount: -1250, Currency: "USD"}, -12},
+		{Money{Amount: 99, Currency: "EUR"}, 0},
+		{Money{Amount: 1250, Currency: "KWD"}, 1},
+		{Money{Amount: 150, Currency: "JPY"}, 150},
+	} {
+		if got := test.money.WholeUnits(); got != test.want {
+			t.Errorf("%v is %d in whole units, want %d", test.money, got, test.want)
+		}
+	}
+}
+
+func TestConvertToMinorUnits(t *testing.T) {
+	// A database of the stage 4 program, which kept whole units in the balance column.
+	db := openTestDB(t, sqlite.Open(filepath.Join(t.TempDir(), "card.s3db")))
+	for _, statement := range []string{
+		"CREATE TABLE cards (id INTEGER PRIMARY KEY, created_at DATETIME, updated_at DATETIME, deleted_at DATETIME, " +
+			"number TEXT UNIQUE NOT NULL, pin TEXT, balance INTEGER DEFAULT 0)",
+		"INSERT INTO cards (number, pin, balance) VALUES ('4000003972196502', '1234', 10000), ('4000000000000010', '4321', 0)",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("cannot set up the old database: %v", err)
+		}
+	}
+	cards, err := NewGormCardRepository(db)
+	if err != nil {
+		t.Fatalf("cannot migrate the old database: %v", err)
+	}
+	service := NewService(cards, DefaultConfig())
+
+	card, err := service.GetCard("4000003972196502")
+	if err != nil {
+		t.Fatalf("cannot load the card: %v", err)
+	}
+	if card.Money() != usd(1000000) || card.WholeBalance != 10000 {
+		t.Errorf("card holds %v and %d whole units, want 10000.00 USD in both", card.Money(), card.WholeBalance)
+	}
+
+	// The balance column keeps whole units through every change of the balance.
+	recipient, _ := service.GetCard("4000000000000010")
+	if err := service.Deposit(card, usd(1500050)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	if err := service.Transfer(card, recipient.Number, usd(1000025)); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	for number, want := range map[string]int64{card.Number: 15000, recipient.Number: 10000} {
+		var whole int64
+		if err := db.Raw("SELECT balance FROM cards WHERE number = ?", number).Scan(&whole).Error; err != nil || whole != want {
+			t.Errorf("balance column of %s holds %d, %v, want %d", number, whole, err, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package bank
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+// PIN hashing parameters. PINs are stored as "pbkdf2-sha256$<iterations>$<salt>$<hash>"
+// with the salt and hash base64 encoded.
+const (
+	PINHashScheme     = "pbkdf2-sha256"
+	PINHashIterations = 100_000
+	PINSaltBytes      = 16
+	PINHashBytes      = 32
+)
+
+// pbkdf2 derives a key from password and salt with PBKDF2-HMAC-SHA256 (RFC 8018).
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+// HashPIN returns a salted PBKDF2 hash of pin suitable for storing in the cards table.
+func HashPIN(pin string) (string, error) {
+	salt := make([]byte, PINSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("cannot generate PIN salt: %v", err)
+	}
+
+	hash := pbkdf2([]byte(pin), salt, PINHashIterations, PINHashBytes)
+	return fmt.Sprintf("%s$%d$%s$%s", PINHashScheme, PINHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPIN reports whether pin matches the stored hash, comparing in constant time.
+func VerifyPIN(pin, stored string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != PINHashScheme {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	got := pbkdf2([]byte(pin), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// dummyPINHash is verified against when the card number is unknown, so that a failed login
+// takes the same time whether or not the card exists.
+var dummyPINHash, _ = HashPIN("0000")
+
+// hashPlaintextPINs converts PINs stored in plaintext by earlier versions into salted hashes.
+// Rows that are already hashed are left untouched, so it is safe to run on every startup.
+func hashPlaintextPINs(db *gorm.DB) error {
+	var cards []cardsV1
+	result := db.Unscoped().Where("pin NOT LIKE ?", PINHashScheme+"$%").Find(&cards)
+	if result.Error != nil {
+		return fmt.Errorf("failed to load plaintext PINs: %v", result.Error)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, card := range cards {
+			pinHash, err := HashPIN(card.PIN)
+			if err != nil {
+				return err
+			}
+
+			result := tx.Unscoped().Model(&cardsV1{}).Where("id = ?", card.ID).Update("pin", pinHash)
+			if result.Error != nil {
+				return fmt.Errorf("failed to hash PIN of card %s: %v", card.Number, result.Error)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package bank
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors of PBKDF2-HMAC-SHA256, in the style of RFC 6070.
+	for _, test := range []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096,
+			"348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+	} {
+		got := hex.EncodeToString(pbkdf2([]byte(test.password), []byte(test.salt), test.iterations, len(test.want)/2))
+		if got != test.want {
+			t.Errorf("PBKDF2 of %q with %q and %d iterations is %s, want %s", test.password, test.salt, test.iterations, got, test.want)
+		}
+	}
+}
+
+func TestHashPIN(t *testing.T) {
+	first, err := HashPIN("1234")
+	if err != nil {
+		t.Fatalf("cannot hash PIN: %v", err)
+	}
+	second, err := HashPIN("1234")
+	if err != nil {
+		t.Fatalf("cannot hash PIN: %v", err)
+	}
+	if first == second {
+		t.Errorf("the same PIN hashed twice gave %s both times, want different salts", first)
+	}
+	if !strings.HasPrefix(first, PINHashScheme+"$") || strings.Contains(first, "1234") {
+		t.Errorf("hash %s does not look like a salted %s hash", first, PINHashScheme)
+	}
+
+	for _, stored := range []string{first, second} {
+		if !VerifyPIN("1234", stored) {
+			t.Errorf("the PIN does not match %s", stored)
+		}
+		if VerifyPIN("1235", stored) {
+			t.Errorf("a wrong PIN matches %s", stored)
+		}
+	}
+	parts := strings.Split(first, "$")
+	for _, stored := range []string{
+		"1234",
+		"",
+		"md5$1$c2FsdA$aGFzaA",
+		strings.Join([]string{parts[0], "0", parts[2], parts[3]}, "$"),
+		strings.Join([]string{parts[0], parts[1], "not base64!", parts[3]}, "$"),
+		strings.Join(parts[:3], "$"),
+	} {
+		if VerifyPIN("1234", stored) {
+			t.Errorf("the PIN matches the malformed hash %q", stored)
+		}
+	}
+}
+
+func TestHashPlaintextPINs(t *testing.T) {
+	service := newTestService(t, DefaultConfig())
+	plaintext := createTestCard(t, service.cards, "4000000000000002", 0)
+	if err := serviceDB(service).Model(&Card{}).Where("id = ?", plaintext.ID).Update("pin", "4321").Error; err != nil {
+		t.Fatalf("cannot store a plaintext PIN: %v", err)
+	}
+	hashed := createTestCard(t, service.cards, "4000000000000010", 0)
+
+	// Running it twice hashes the plaintext PIN once and leaves the hashed one alone.
+	for i := 0; i < 2; i++ {
+		if err := hashPlaintextPINs(serviceDB(service)); err != nil {
+			t.Fatalf("cannot hash plaintext PINs: %v", err)
+		}
+	}
+	if card, _ := service.GetCard(plaintext.Number); !VerifyPIN("4321", card.PIN) {
+		t.Errorf("plaintext PIN became %q, want a hash of it", card.PIN)
+	}
+	if card, _ := service.GetCard(hashed.Number); card.PIN != hashed.PIN {
+		t.Errorf("hashed PIN became %q, want it unchanged", card.PIN)
+	}
+}
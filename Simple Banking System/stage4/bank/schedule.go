@@ -0,0 +1,301 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Schedules of the scheduled transfers
+const (
+	ScheduleOnce    = "once"
+	ScheduleDaily   = "daily"
+	ScheduleWeekly  = "weekly"
+	ScheduleMonthly = "monthly"
+)
+
+// Scheduled transfer statuses
+const (
+	ScheduledActive    = "active"
+	ScheduledCompleted = "completed"
+	ScheduledFailed    = "failed"
+	ScheduledCancelled = "cancelled"
+)
+
+// Default retry policy of the scheduled transfers
+const (
+	DefaultScheduleMaxAttempts = 3
+	DefaultScheduleRetryDelay  = time.Hour
+)
+
+// Failures of the scheduled transfers
+var (
+	ErrUnknownSchedule            = errors.New("unknown schedule")
+	ErrScheduleInPast             = errors.New("the first transfer cannot be scheduled in the past")
+	ErrScheduledTransferNotFound  = errors.New("scheduled transfer not found")
+	ErrScheduledTransferNotActive = errors.New("scheduled transfer is not active")
+	ErrScheduleChanged            = errors.New("scheduled transfer changed meanwhile")
+)
+
+// Schedules lists the valid schedules in the order they are offered.
+var Schedules = []string{ScheduleOnce, ScheduleDaily, ScheduleWeekly, ScheduleMonthly}
+
+// ScheduledTransfer is a standing order moving Amount from the card SenderNumber to the card
+// RecipientNumber on every run of Schedule, the first one at StartAt.
+type ScheduledTransfer struct {
+	gorm.Model
+	SenderNumber    string `gorm:"index;not null"`
+	RecipientNumber string `gorm:"not null"`
+	Amount          int64  `gorm:"not null"` // in minor units of Currency
+	Currency        string `gorm:"not null;default:USD"`
+	Schedule        string `gorm:"not null"`
+	StartAt         time.Time
+
+	// Occurrence is the number of runs of the schedule done or given up, which is also the index
+	// of the next one. NextRunAt is when it is due, or retried after Attempts failed attempts.
+	Occurrence int       `gorm:"not null;default:0"`
+	NextRunAt  time.Time `gorm:"index"`
+	Attempts   int       `gorm:"not null;default:0"`
+
+	Status    string `gorm:"not null;default:active"`
+	LastRunAt *time.Time
+	// LastError describes the last failed attempt; it is cleared by a successful run.
+	LastError string
+}
+
+// Money returns the amount of the transfer.
+func (t *ScheduledTransfer) Money() Money {
+	return Money{Amount: t.Amount, Currency: t.Currency}
+}
+
+// occurrence returns when run n, counted from 0, of the transfer is due, and false if the
+// schedule has no such run. Monthly transfers run on the day of the month of StartAt, or on the
+// last day of the shorter months.
+func (t *ScheduledTransfer) occurrence(n int) (time.Time, bool) {
+	switch t.Schedule {
+	case ScheduleOnce:
+		return t.StartAt, n == 0
+	case ScheduleDaily:
+		return t.StartAt.AddDate(0, 0, n), true
+	case ScheduleWeekly:
+		return t.StartAt.AddDate(0, 0, 7*n), true
+	default:
+		year, month, day := t.StartAt.Date()
+		hour, minute, second := t.StartAt.Clock()
+		first := time.Date(year, month+time.Month(n), 1, hour, minute, second, t.StartAt.Nanosecond(), t.StartAt.Location())
+		lastDay := first.AddDate(0, 1, -1).Day()
+		return first.AddDate(0, 0, min(day, lastDay)-1), true
+	}
+}
+
+// advance moves the transfer to its next run, completing it if there is none.
+func (t *ScheduledTransfer) advance() {
+	t.Occurrence++
+	t.Attempts = 0
+	next, ok := t.occurrence(t.Occurrence)
+	if !ok {
+		t.Status = ScheduledCompleted
+		return
+	}
+	t.NextRunAt = next
+}
+
+// RetryPolicy decides how a scheduled transfer that failed is retried.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a run is attempted in all. A run that still fails is given
+	// up: a one-off transfer fails and a recurring one waits for its next run.
+	MaxAttempts int
+	// Delay is the wait before the first retry, doubled before every further one.
+	Delay time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: DefaultScheduleMaxAttempts, Delay: DefaultScheduleRetryDelay}
+}
+
+// retryable tells whether a run that failed with err may succeed later. Cards that can no longer
+// be used end the transfer, except lost cards, which may be reissued meanwhile.
+func retryable(err error) bool {
+	for _, permanent := range []error{
+		ErrCardNotFound, ErrAccountClosed, ErrCardReplaced, ErrCurrencyMismatch, ErrInvalidAmount,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// fail records the failure of an attempt at now, and schedules the retry allowed by policy.
+func (t *ScheduledTransfer) fail(err error, now time.Time, policy RetryPolicy) {
+	t.Attempts++
+	t.LastError = err.Error()
+	t.LastRunAt = &now
+
+	switch {
+	case !retryable(err):
+		t.Status = ScheduledFailed
+	case t.Attempts < policy.MaxAttempts:
+		t.NextRunAt = now.Add(policy.Delay << (t.Attempts - 1))
+	case t.Schedule == ScheduleOnce:
+		t.Status = ScheduledFailed
+	default:
+		t.advance()
+	}
+}
+
+// ScheduleRequest describes a scheduled transfer.
+type ScheduleRequest struct {
+	RecipientCardNumber string
+	// Amount is in the currency of the sender.
+	Amount   Money
+	Schedule string
+	// StartAt is when the first transfer is due. It must not be before the current day.
+	StartAt time.Time
+}
+
+// ScheduleTransfer records a transfer from sender following request, which is checked like an
+// immediate transfer. RunDueTransfers executes it once it is due.
+func (s *Service) ScheduleTransfer(sender *Card, request ScheduleRequest) (*ScheduledTransfer, error) {
+	if _, err := s.CheckRecipient(sender, request.RecipientCardNumber); err != nil {
+		return nil, err
+	}
+	if request.Amount.Currency != sender.Currency {
+		return nil, fmt.Errorf("%w: cannot transfer %s from a %s card", ErrCurrencyMismatch, request.Amount.Currency, sender.Currency)
+	}
+	if !request.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	if err := s.config.TransferLimits.Check(request.Amount); err != nil {
+		return nil, err
+	}
+
+	known := false
+	for _, schedule := range Schedules {
+		known = known || schedule == request.Schedule
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSchedule, request.Schedule)
+	}
+	start := request.StartAt.UTC()
+	if start.Before(s.Now().UTC().Truncate(24 * time.Hour)) {
+		return nil, ErrScheduleInPast
+	}
+
+	transfer := &ScheduledTransfer{
+		SenderNumber:    sender.Number,
+		RecipientNumber: request.RecipientCardNumber,
+		Amount:          request.Amount.Amount,
+		Currency:        request.Amount.Currency,
+		Schedule:        request.Schedule,
+		StartAt:         start,
+		NextRunAt:       start,
+		Status:          ScheduledActive,
+	}
+	if err := s.cards.CreateScheduledTransfer(transfer); err != nil {
+		return nil, fmt.Errorf("cannot schedule transfer: %w", err)
+	}
+	return transfer, nil
+}
+
+// ScheduledTransfers returns the active scheduled transfers from card.
+func (s *Service) ScheduledTransfers(card *Card) ([]ScheduledTransfer, error) {
+	return s.cards.ScheduledTransfers(card.Number)
+}
+
+// CancelScheduledTransfer cancels the active scheduled transfer with the given ID from card.
+func (s *Service) CancelScheduledTransfer(card *Card, id uint) error {
+	transfer, err := s.cards.FindScheduledTransfer(id)
+	if err != nil {
+		return err
+	}
+	if transfer.SenderNumber != card.Number {
+		return ErrScheduledTransferNotFound
+	}
+	if transfer.Status != ScheduledActive {
+		return ErrScheduledTransferNotActive
+	}
+
+	cancelled := *transfer
+	cancelled.Status = ScheduledCancelled
+	return s.cards.UpdateScheduledTransfer(transfer, &cancelled)
+}
+
+// ScheduledRun is the outcome of an attempt at a scheduled transfer.
+type ScheduledRun struct {
+	// Transfer is the scheduled transfer after the attempt.
+	Transfer ScheduledTransfer
+	// Err is why the attempt failed, nil if the money was transferred.
+	Err error
+}
+
+// RunDueTransfers executes the scheduled transfers that are due by the clock of the Service,
+// including the runs missed while it was not called, and returns the outcome of every attempt.
+// Each transfer moves the money in the transaction that advances its schedule, so transfers run
+// concurrently by another process are not executed twice. Failed attempts are recorded and
+// retried following the configured RetryPolicy.
+func (s *Service) RunDueTransfers() ([]ScheduledRun, error) {
+	// The times are kept in UTC, which SQLite needs to compare them as text.
+	now := s.Now().UTC()
+	var runs []ScheduledRun
+	for {
+		due, err := s.cards.DueScheduledTransfers(now)
+		if err != nil {
+			return runs, fmt.Errorf("cannot load due transfers: %w", err)
+		}
+		if len(due) == 0 {
+			return runs, nil
+		}
+
+		for i := range due {
+			run, err := s.runScheduledTransfer(&due[i], now)
+			if errors.Is(err, ErrScheduleChanged) {
+				continue
+			}
+			if err != nil {
+				return runs, err
+			}
+			runs = append(runs, *run)
+		}
+	}
+}
+
+// runScheduledTransfer attempts the due run of transfer at now and records its outcome. It fails
+// with ErrScheduleChanged if another process got to the transfer first.
+func (s *Service) runScheduledTransfer(transfer *ScheduledTransfer, now time.Time) (*ScheduledRun, error) {
+	done := *transfer
+	done.advance()
+	done.LastRunAt, done.LastError = &now, ""
+	err := s.cards.Transaction(func(cards CardRepository) error {
+		if err := cards.UpdateScheduledTransfer(transfer, &done); err != nil {
+			return err
+		}
+
+		recipient, err := findOpenCard(cards, transfer.RecipientNumber)
+		if err != nil {
+			return err
+		}
+		// The entries are dated now, so runs caught up on late never change a closed period of
+		// the ledger; when the run was due is recorded beside.
+		entry := s.ledgerEntry(KindTransfer)
+		if due, ok := transfer.occurrence(transfer.Occurrence); ok {
+			entry.ScheduledFor = &due
+		}
+		_, _, err = s.moveMoney(cards, entry, transfer.SenderNumber, recipient, transfer.Money())
+		return err
+	})
+	if err == nil {
+		return &ScheduledRun{Transfer: done}, nil
+	}
+	if errors.Is(err, ErrScheduleChanged) {
+		return nil, err
+	}
+
+	failed := *transfer
+	failed.fail(err, now, s.config.ScheduleRetry)
+	if updateErr := s.cards.UpdateScheduledTransfer(transfer, &failed); updateErr != nil {
+		return nil, fmt.Errorf("cannot record failure of scheduled transfer %d: %w", transfer.ID, updateErr)
+	}
+	return &ScheduledRun{Transfer: failed, Err: err}, nil
+}
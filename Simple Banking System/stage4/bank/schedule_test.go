@@ -0,0 +1,290 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newScheduleTestService returns a service whose clock reads *now, and two cards, the first one
+// holding balance.
+func newScheduleTestService(t *testing.T, now *time.Time, balance int64) (*Service, *Card, *Card) {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Clock = func() time.Time { return *now }
+	config.ScheduleRetry = RetryPolicy{MaxAttempts: 3, Delay: time.Hour}
+	service := NewService(NewMemoryCardRepository(), config)
+	sender, _, _ := service.CreateAccount(DefaultCurrency, "")
+	recipient, _, _ := service.CreateAccount(DefaultCurrency, "")
+	if balance != 0 {
+		if err := service.Deposit(sender, Money{Amount: balance, Currency: DefaultCurrency}); err != nil {
+			t.Fatalf("deposit failed: %v", err)
+		}
+	}
+	return service, sender, recipient
+}
+
+func scheduleTestTransfer(t *testing.T, service *Service, sender, recipient *Card, schedule string, start time.Time) *ScheduledTransfer {
+	t.Helper()
+
+	transfer, err := service.ScheduleTransfer(sender, ScheduleRequest{
+		RecipientCardNumber: recipient.Number,
+		Amount:              Money{Amount: 100, Currency: DefaultCurrency},
+		Schedule:            schedule,
+		StartAt:             start,
+	})
+	if err != nil {
+		t.Fatalf("cannot schedule transfer: %v", err)
+	}
+	return transfer
+}
+
+func runDueTransfers(t *testing.T, service *Service) []ScheduledRun {
+	t.Helper()
+
+	runs, err := service.RunDueTransfers()
+	if err != nil {
+		t.Fatalf("cannot run the due transfers: %v", err)
+	}
+	return runs
+}
+
+func TestScheduledTransferOccurrences(t *testing.T) {
+	start := time.Date(2030, time.January, 31, 8, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		schedule string
+		want     []time.Time
+	}{
+		{ScheduleOnce, []time.Time{start}},
+		{ScheduleDaily, []time.Time{start, start.AddDate(0, 0, 1), start.AddDate(0, 0, 2)}},
+		{ScheduleWeekly, []time.Time{start, start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)}},
+		{ScheduleMonthly, []time.Time{
+			start,
+			time.Date(2030, time.February, 28, 8, 0, 0, 0, time.UTC),
+			time.Date(2030, time.March, 31, 8, 0, 0, 0, time.UTC),
+		}},
+	} {
+		transfer := ScheduledTransfer{Schedule: test.schedule, StartAt: start}
+		for n, want := range test.want {
+			if got, ok := transfer.occurrence(n); !ok || !got.Equal(want) {
+				t.Errorf("%s run %d is due at %v, %t, want %v", test.schedule, n, got, ok, want)
+			}
+		}
+		if _, ok := transfer.occurrence(len(test.want)); ok && test.schedule == ScheduleOnce {
+			t.Errorf("one-off transfer has a second run")
+		}
+	}
+}
+
+func TestRunDueTransfersCatchesUp(t *testing.T) {
+	now := time.Date(2030, time.January, 20, 12, 0, 0, 0, time.UTC)
+	service, sender, recipient := newScheduleTestService(t, &now, 1000)
+	monthly := scheduleTestTransfer(t, service, sender, recipient, ScheduleMonthly, time.Date(2030, time.January, 31, 0, 0, 0, 0, time.UTC))
+	once := scheduleTestTransfer(t, service, sender, recipient, ScheduleOnce, time.Date(2030, time.February, 1, 0, 0, 0, 0, time.UTC))
+
+	if runs := runDueTransfers(t, service); len(runs) != 0 {
+		t.Errorf("ran %d transfers before they were due", len(runs))
+	}
+
+	now = time.Date(2030, time.March, 31, 0, 0, 0, 0, time.UTC)
+	runs := runDueTransfers(t, service)
+	if len(runs) != 4 {
+		t.Fatalf("ran %d transfers, want the 3 monthly runs and the one-off", len(runs))
+	}
+	for _, run := range runs {
+		if run.Err != nil {
+			t.Errorf("scheduled transfer %d failed: %v", run.Transfer.ID, run.Err)
+		}
+	}
+	if balance, _ := service.Balance(recipient.Number); balance.Amount != 400 {
+		t.Errorf("recipient has %v, want 4.00", balance)
+	}
+	history, _ := service.History(sender.Number, 10)
+	if len(history) != 5 || history[0].Kind != KindTransfer {
+		t.Fatalf("sender history has %d entries, want the deposit and 4 transfers", len(history))
+	}
+	// The transfers are dated when they were caught up on, which leaves the closed periods of the
+	// ledger as they were, and record when they were due.
+	for i, due := range []time.Time{
+		time.Date(2030, time.March, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2030, time.February, 28, 0, 0, 0, 0, time.UTC),
+		time.Date(2030, time.February, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2030, time.January, 31, 0, 0, 0, 0, time.UTC),
+	} {
+		if entry := history[i]; !entry.CreatedAt.Equal(now) || entry.ScheduledFor == nil || !entry.ScheduledFor.Equal(due) {
+			t.Errorf("transfer %d is dated %v and scheduled for %v, want %v and %v", i, entry.CreatedAt, entry.ScheduledFor, now, due)
+		}
+	}
+	if history[4].ScheduledFor != nil {
+		t.Errorf("deposit is scheduled for %v, want nil", history[4].ScheduledFor)
+	}
+
+	if runs := runDueTransfers(t, service); len(runs) != 0 {
+		t.Errorf("ran %d transfers again", len(runs))
+	}
+	stored, _ := service.cards.FindScheduledTransfer(monthly.ID)
+	if stored.Occurrence != 3 || !stored.NextRunAt.Equal(time.Date(2030, time.April, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthly transfer did %d runs and is next due at %v, want 3 and April 30", stored.Occurrence, stored.NextRunAt)
+	}
+	if stored, _ := service.cards.FindScheduledTransfer(once.ID); stored.Status != ScheduledCompleted {
+		t.Errorf("one-off transfer has status %q after its run, want %q", stored.Status, ScheduledCompleted)
+	}
+}
+
+func TestRunDueTransfersRetries(t *testing.T) {
+	start := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	service, sender, recipient := newScheduleTestService(t, &now, 0)
+	once := scheduleTestTransfer(t, service, sender, recipient, ScheduleOnce, start)
+
+	runs := runDueTransfers(t, service)
+	if len(runs) != 1 || !errors.Is(runs[0].Err, ErrInsufficientFunds) {
+		t.Fatalf("runs are %+v, want a failure for insufficient funds", runs)
+	}
+	if transfer := runs[0].Transfer; transfer.Attempts != 1 || !transfer.NextRunAt.Equal(start.Add(time.Hour)) || transfer.LastError == "" {
+		t.Errorf("failed transfer is %+v, want a retry after an hour", transfer)
+	}
+
+	// The second retry waits twice as long as the first.
+	now = start.Add(time.Hour)
+	if runs := runDueTransfers(t, service); len(runs) != 1 || !runs[0].Transfer.NextRunAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("second attempt is %+v, want a retry after two hours", runs)
+	}
+
+	if err := service.Deposit(sender, Money{Amount: 100, Currency: DefaultCurrency}); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	runs = runDueTransfers(t, service)
+	if len(runs) != 1 || runs[0].Err != nil || runs[0].Transfer.Status != ScheduledCompleted || runs[0].Transfer.LastError != "" {
+		t.Errorf("last attempt is %+v, want a completed transfer", runs)
+	}
+	if balance, _ := service.Balance(recipient.Number); balance.Amount != 100 {
+		t.Errorf("recipient has %v, want 1.00", balance)
+	}
+	// The retry still records the run it was due for.
+	if history, _ := service.History(recipient.Number, 1); len(history) != 1 || history[0].ScheduledFor == nil || !history[0].ScheduledFor.Equal(start) {
+		t.Errorf("recipient history is %+v, want the transfer scheduled for %v", history, start)
+	}
+	if stored, _ := service.cards.FindScheduledTransfer(once.ID); stored.Status != ScheduledCompleted {
+		t.Errorf("stored transfer has status %q, want %q", stored.Status, ScheduledCompleted)
+	}
+}
+
+func TestRunDueTransfersGivesUp(t *testing.T) {
+	start := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	service, sender, recipient := newScheduleTestService(t, &now, 0)
+	once := scheduleTestTransfer(t, service, sender, recipient, ScheduleOnce, start)
+	daily := scheduleTestTransfer(t, service, sender, recipient, ScheduleDaily, start)
+
+	// Retries are timed from the failed attempt, so each call makes a single attempt.
+	for _, hours := range []int{0, 1, 3} {
+		now = start.Add(time.Duration(hours) * time.Hour)
+		if runs := runDueTransfers(t, service); len(runs) != 2 {
+			t.Fatalf("made %d attempts at %v, want one of each transfer", len(runs), now)
+		}
+	}
+	if stored, _ := service.cards.FindScheduledTransfer(once.ID); stored.Status != ScheduledFailed || stored.Attempts != 3 {
+		t.Errorf("one-off transfer has status %q after %d attempts, want %q after 3", stored.Status, stored.Attempts, ScheduledFailed)
+	}
+	stored, _ := service.cards.FindScheduledTransfer(daily.ID)
+	if stored.Status != ScheduledActive || stored.Occurrence != 1 || stored.Attempts != 0 || !stored.NextRunAt.Equal(start.AddDate(0, 0, 1)) {
+		t.Errorf("daily transfer is %+v, want it to wait for the next day", stored)
+	}
+}
+
+func TestRunDueTransfersToClosedCardFails(t *testing.T) {
+	now := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	service, sender, recipient := newScheduleTestService(t, &now, 1000)
+	transfer := scheduleTestTransfer(t, service, sender, recipient, ScheduleWeekly, now)
+	if _, err := service.Close(recipient, CloseRequest{Reason: "test"}); err != nil {
+		t.Fatalf("cannot close recipient: %v", err)
+	}
+
+	runs := runDueTransfers(t, service)
+	if len(runs) != 1 || !errors.Is(runs[0].Err, ErrAccountClosed) || runs[0].Transfer.Status != ScheduledFailed {
+		t.Errorf("runs are %+v, want the transfer to fail for good", runs)
+	}
+	if balance, _ := service.Balance(sender.Number); balance.Amount != 1000 {
+		t.Errorf("sender has %v after the failed transfer, want 10.00", balance)
+	}
+	if transfers, _ := service.ScheduledTransfers(sender); len(transfers) != 0 {
+		t.Errorf("failed transfer %d is still active", transfer.ID)
+	}
+}
+
+func TestScheduleTransferChecksRequest(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 18, 0, 0, 0, time.UTC)
+	service, sender, recipient := newScheduleTestService(t, &now, 0)
+	request := ScheduleRequest{
+		RecipientCardNumber: recipient.Number,
+		Amount:              Money{Amount: 100, Currency: DefaultCurrency},
+		Schedule:            "yearly",
+		StartAt:             time.Date(2030, time.January, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	if _, err := service.ScheduleTransfer(sender, request); !errors.Is(err, ErrUnknownSchedule) {
+		t.Errorf("scheduling yearly failed with %v, want %v", err, ErrUnknownSchedule)
+	}
+	request.Schedule = ScheduleDaily
+	request.RecipientCardNumber = sender.Number
+	if _, err := service.ScheduleTransfer(sender, request); !errors.Is(err, ErrSameAccount) {
+		t.Errorf("scheduling a transfer to the sender failed with %v, want %v", err, ErrSameAccount)
+	}
+	request.RecipientCardNumber = recipient.Number
+	request.StartAt = request.StartAt.AddDate(0, 0, -1)
+	if _, err := service.ScheduleTransfer(sender, request); !errors.Is(err, ErrScheduleInPast) {
+		t.Errorf("scheduling yesterday failed with %v, want %v", err, ErrScheduleInPast)
+	}
+
+	// Today is not in the past, even though its midnight is.
+	request.StartAt = request.StartAt.AddDate(0, 0, 1)
+	transfer, err := service.ScheduleTransfer(sender, request)
+	if err != nil {
+		t.Fatalf("cannot schedule a transfer today: %v", err)
+	}
+	if err := service.CancelScheduledTransfer(recipient, transfer.ID); !errors.Is(err, ErrScheduledTransferNotFound) {
+		t.Errorf("cancelling from another card failed with %v, want %v", err, ErrScheduledTransferNotFound)
+	}
+	if err := service.CancelScheduledTransfer(sender, transfer.ID); err != nil {
+		t.Fatalf("cannot cancel transfer: %v", err)
+	}
+	if err := service.CancelScheduledTransfer(sender, transfer.ID); !errors.Is(err, ErrScheduledTransferNotActive) {
+		t.Errorf("cancelling twice failed with %v, want %v", err, ErrScheduledTransferNotActive)
+	}
+	if runs := runDueTransfers(t, service); len(runs) != 0 {
+		t.Errorf("ran %d cancelled transfers", len(runs))
+	}
+}
+
+func TestReissueMovesScheduledTransfers(t *testing.T) {
+	now := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	service, sender, recipient := newScheduleTestService(t, &now, 1000)
+	scheduleTestTransfer(t, service, sender, recipient, ScheduleDaily, now)
+	scheduleTestTransfer(t, service, recipient, sender, ScheduleDaily, now.AddDate(0, 0, 1))
+
+	if err := service.ReportLost(recipient); err != nil {
+		t.Fatalf("cannot report card lost: %v", err)
+	}
+	replacement, _, err := service.Reissue(recipient)
+	if err != nil {
+		t.Fatalf("cannot reissue card: %v", err)
+	}
+	newSender, _, err := service.Reissue(sender)
+	if err != nil {
+		t.Fatalf("cannot reissue card: %v", err)
+	}
+
+	runs := runDueTransfers(t, service)
+	if len(runs) != 1 || runs[0].Err != nil || runs[0].Transfer.RecipientNumber != replacement.Number {
+		t.Errorf("runs are %+v, want a transfer to the replacement card", runs)
+	}
+	if transfers, _ := service.ScheduledTransfers(newSender); len(transfers) != 1 {
+		t.Errorf("replacement sender has %d scheduled transfers, want 1", len(transfers))
+	}
+	if transfers, _ := service.ScheduledTransfers(replacement); len(transfers) != 1 || transfers[0].RecipientNumber != newSender.Number {
+		t.Errorf("scheduled transfers of the replacement card are %+v, want one to %s", transfers, newSender.Number)
+	}
+}
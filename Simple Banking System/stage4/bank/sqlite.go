@@ -0,0 +1,46 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"net/url"
+	"time"
+)
+
+// SQLite connection settings
+const (
+	// BusyTimeout is how long SQLite waits for a lock held by another connection before failing
+	// with SQLITE_BUSY.
+	BusyTimeout = 5 * time.Second
+	// DefaultMaxBusyRetries is how many times a transaction that still failed on lock contention
+	// is run again.
+	DefaultMaxBusyRetries = 5
+	// BusyRetryDelay is the base delay before running a transaction again. It grows with every
+	// attempt and is jittered so that competing sessions do not retry in lockstep.
+	BusyRetryDelay = 20 * time.Millisecond
+)
+
+// SQLiteDSN returns the data source name that opens the SQLite database at path for use by
+// several sessions at once, possibly from different processes: readers do not block the writer
+// in WAL mode, a connection waits up to BusyTimeout for a lock, and transactions start with
+// BEGIN IMMEDIATE so that they take the write lock up front instead of failing when they upgrade
+// a read lock halfway through.
+func SQLiteDSN(path string) string {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprint(BusyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate")
+	// The path is escaped so that characters such as ? and # are not taken for the parameters.
+	dsn := url.URL{Scheme: "file", Opaque: url.PathEscape(path), RawQuery: params.Encode()}
+	return dsn.String()
+}
+
+// isBusy reports whether err is SQLite failing to get a lock held by another connection.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
@@ -0,0 +1,31 @@
+package bank
+
+import (
+	"gorm.io/driver/sqlite"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteDSNEscapesPath(t *testing.T) {
+	// Without escaping, ? would start the parameters, # a fragment and %20 would be decoded.
+	path := filepath.Join(t.TempDir(), "my bank?mode=ro#1 %20", "card.db")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+
+	createTestCard(t, openTestRepository(t, sqlite.Open(SQLiteDSN(path))), "4000000000000002", 100)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("database is not at %s: %v", path, err)
+	}
+
+	// The parameters still apply.
+	var journalMode string
+	db := openTestDB(t, sqlite.Open(SQLiteDSN(path)))
+	if err := db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error; err != nil || journalMode != "wal" {
+		t.Errorf("journal mode is %q, %v, want wal", journalMode, err)
+	}
+	if card, err := openTestRepository(t, sqlite.Open(SQLiteDSN(path))).FindByNumber("4000000000000002"); err != nil || card.Balance != 100 {
+		t.Errorf("reopened database has card %+v, %v", card, err)
+	}
+}
@@ -0,0 +1,80 @@
+package bank
+
+import (
+	"time"
+)
+
+// MonthlyStatement sums up the ledger entries of an account during a calendar month in UTC.
+type MonthlyStatement struct {
+	CardNumber string
+	// Month is the first day of the month.
+	Month time.Time
+	// Entries are the ledger entries of the account of the card made during the month, oldest
+	// first, whichever of its cards they were made with.
+	Entries []Transaction
+	Opening Money
+	Credits Money
+	Debits  Money
+	// Interest is the part of Credits that is capitalized interest.
+	Interest Money
+	Closing  Money
+}
+
+// MonthlyStatement returns the statement of the account of card for the month of month. Entries
+// belong to the month they were made in: interest earned in a month is capitalized, and listed,
+// in the next one.
+func (s *Service) MonthlyStatement(card *Card, month time.Time) (*MonthlyStatement, error) {
+	current, err := s.cards.FindByNumber(card.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	year, m, _ := month.UTC().Date()
+	start := time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	// Since selects the entries made after it, so it is moved back to include those made right as
+	// the month begins.
+	entries, err := s.cards.Entries(EntryQuery{AccountID: current.AccountID, Since: start.Add(-time.Nanosecond), Until: end})
+	if err != nil {
+		return nil, err
+	}
+	later, err := s.cards.Entries(EntryQuery{AccountID: current.AccountID, Since: end.Add(-time.Nanosecond)})
+	if err != nil {
+		return nil, err
+	}
+
+	zero := Money{Currency: current.Currency}
+	statement := &MonthlyStatement{
+		CardNumber: current.Number, Month: start, Entries: entries, Credits: zero, Debits: zero, Interest: zero,
+	}
+	for _, entry := range entries {
+		if entry.Entry == EntryDebit {
+			statement.Debits, err = statement.Debits.Add(entry.Money())
+		} else if statement.Credits, err = statement.Credits.Add(entry.Money()); err == nil && entry.Kind == KindInterest {
+			statement.Interest, err = statement.Interest.Add(entry.Money())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The closing balance is the current one without the entries made since the month ended.
+	statement.Closing = current.Money()
+	for _, entry := range later {
+		if entry.Entry == EntryCredit {
+			statement.Closing, err = statement.Closing.Sub(entry.Money())
+		} else {
+			statement.Closing, err = statement.Closing.Add(entry.Money())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if statement.Opening, err = statement.Closing.Sub(statement.Credits); err != nil {
+		return nil, err
+	}
+	if statement.Opening, err = statement.Opening.Add(statement.Debits); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
@@ -0,0 +1,68 @@
+package bank
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthlyStatement(t *testing.T) {
+	// The statements cover months in UTC, whatever the local time zone.
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	forEachBackend(t, func(t *testing.T, session func() CardRepository) {
+		now := time.Date(2030, time.January, 20, 12, 0, 0, 0, time.Local)
+		config := DefaultConfig()
+		config.Clock = func() time.Time { return now }
+		profile := DefaultIssuerProfile()
+		profile.InterestRate = 365
+		config.IssuerProfiles = IssuerProfiles{profile}
+		service := NewService(session(), config)
+		card, _, err := service.CreateAccount(DefaultCurrency, "")
+		if err != nil {
+			t.Fatalf("cannot create card: %v", err)
+		}
+
+		money := func(amount int64) Money { return Money{Amount: amount, Currency: DefaultCurrency} }
+		if err := service.Deposit(card, money(100000)); err != nil {
+			t.Fatalf("deposit failed: %v", err)
+		}
+		// 01:00 on February 1 in the local time zone is still January 31 in UTC.
+		now = time.Date(2030, time.February, 1, 1, 0, 0, 0, time.Local)
+		if err := service.Withdraw(card, money(2500)); err != nil {
+			t.Fatalf("withdrawal failed: %v", err)
+		}
+		// The first run accrues January 31 and credits it right away.
+		now = time.Date(2030, time.February, 1, 6, 0, 0, 0, time.UTC)
+		if postings := accrueInterest(t, service); len(postings) != 1 || postings[0].Interest != money(9) {
+			t.Fatalf("credited %+v, want 0.09", postings)
+		}
+
+		for _, want := range []struct {
+			month                                     time.Month
+			entries                                   []string
+			opening, credits, debits, interest, close int64
+		}{
+			{time.January, []string{KindIncome, KindWithdrawal}, 0, 100000, 2500, 0, 97500},
+			{time.February, []string{KindInterest}, 97500, 9, 0, 9, 97509},
+			{time.March, nil, 97509, 0, 0, 0, 97509},
+		} {
+			statement, err := service.MonthlyStatement(card, time.Date(2030, want.month, 15, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("cannot generate statement: %v", err)
+			}
+			var kinds []string
+			for _, entry := range statement.Entries {
+				kinds = append(kinds, entry.Kind)
+			}
+			if len(kinds) != len(want.entries) || len(kinds) > 0 && kinds[0] != want.entries[0] || len(kinds) > 1 && kinds[1] != want.entries[1] {
+				t.Errorf("statement of %v lists %v, want %v", want.month, kinds, want.entries)
+			}
+			if statement.Opening != money(want.opening) || statement.Credits != money(want.credits) ||
+				statement.Debits != money(want.debits) || statement.Interest != money(want.interest) || statement.Closing != money(want.close) {
+				t.Errorf("statement of %v is %+v", want.month, statement)
+			}
+		}
+	})
+}
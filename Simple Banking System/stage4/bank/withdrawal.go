@@ -0,0 +1,174 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// WithdrawalWindow is the rolling period over which the daily withdrawal limit applies.
+const WithdrawalWindow = 24 * time.Hour
+
+// ErrWithdrawalLimit is matched by WithdrawalLimitError.
+var ErrWithdrawalLimit = errors.New("withdrawal limit exceeded")
+
+// WithdrawalLimitError is returned when a withdrawal exceeds the per-transaction or the daily
+// limit of the card. It matches ErrWithdrawalLimit.
+type WithdrawalLimitError struct {
+	Amount Money
+	Limit  Money
+	// Daily is true when the rolling daily limit was exceeded; Remaining is then what can still be
+	// withdrawn within the current window.
+	Daily     bool
+	Remaining Money
+}
+
+func (e *WithdrawalLimitError) Error() string {
+	if e.Daily {
+		return fmt.Sprintf("%v: %v exceeds the daily limit of %v, %v remaining", ErrWithdrawalLimit, e.Amount, e.Limit, e.Remaining)
+	}
+	return fmt.Sprintf("%v: %v exceeds the limit of %v per withdrawal", ErrWithdrawalLimit, e.Amount, e.Limit)
+}
+
+func (e *WithdrawalLimitError) Is(target error) bool {
+	return target == ErrWithdrawalLimit
+}
+
+// WithdrawalLimits returns the per-withdrawal and daily limits that apply to card: its own limits
+// if set, the configured defaults otherwise. A nil limit is not enforced.
+func (s *Service) WithdrawalLimits(card *Card) (perWithdrawal, daily *Money, err error) {
+	perWithdrawal, err = cardLimit(card, card.WithdrawalLimit, s.config.WithdrawalLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	daily, err = cardLimit(card, card.DailyWithdrawalLimit, s.config.DailyWithdrawalLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return perWithdrawal, daily, nil
+}
+
+func cardLimit(card *Card, own *int64, fallback *big.Rat) (*Money, error) {
+	if own != nil {
+		return &Money{Amount: *own, Currency: card.Currency}, nil
+	}
+	if fallback == nil {
+		return nil, nil
+	}
+
+	exponent, err := CurrencyExponent(card.Currency)
+	if err != nil {
+		return nil, err
+	}
+	minorUnits := new(big.Rat).Mul(fallback, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)))
+	limit := new(big.Int).Quo(minorUnits.Num(), minorUnits.Denom())
+	if !limit.IsInt64() {
+		return nil, fmt.Errorf("%w: withdrawal limit %s %s", ErrAmountOverflow, fallback.RatString(), card.Currency)
+	}
+	return &Money{Amount: limit.Int64(), Currency: card.Currency}, nil
+}
+
+// SetWithdrawalLimits sets the per-withdrawal and daily limits of card, in its currency.
+// A nil limit makes the card fall back to the configured default. The JSON API is the only
+// front-end that sets them: the menu leaves every card on the defaults.
+func (s *Service) SetWithdrawalLimits(card *Card, perWithdrawal, daily *Money) error {
+	var amounts [2]*int64
+	for i, limit := range []*Money{perWithdrawal, daily} {
+		if limit == nil {
+			continue
+		}
+		if limit.Currency != card.Currency {
+			return fmt.Errorf("%w: %s limit on a %s card", ErrCurrencyMismatch, limit.Currency, card.Currency)
+		}
+		if !limit.IsPositive() {
+			return ErrInvalidAmount
+		}
+		amounts[i] = &limit.Amount
+	}
+
+	if err := s.cards.SetWithdrawalLimits(card.Number, amounts[0], amounts[1]); err != nil {
+		return err
+	}
+
+	card.WithdrawalLimit, card.DailyWithdrawalLimit = amounts[0], amounts[1]
+	return nil
+}
+
+// Withdraw takes amount out of card and records it in the ledger. The balance, the per-withdrawal
+// limit and the daily limit over the last WithdrawalWindow are all checked in the transaction
+// that debits the card, so concurrent withdrawals cannot exceed them together. card is refreshed
+// with the resulting balance.
+func (s *Service) Withdraw(card *Card, amount Money) error {
+	if amount.Currency != card.Currency {
+		return fmt.Errorf("%w: cannot withdraw %s from a %s card", ErrCurrencyMismatch, amount.Currency, card.Currency)
+	}
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	var updated *Card
+	err := s.cards.Transaction(func(cards CardRepository) error {
+		var err error
+		updated, err = cards.UpdateBalance(card.Number, Money{Amount: -amount.Amount, Currency: amount.Currency})
+		if err != nil {
+			return err
+		}
+
+		// The account is now locked by this transaction, so its recent withdrawals cannot
+		// change until it ends.
+		if err := s.checkWithdrawalLimits(cards, updated, amount); err != nil {
+			return err
+		}
+
+		if err := recordEntries(cards, s.ledgerEntry(KindWithdrawal), updated, nil, amount, amount); err != nil {
+			return fmt.Errorf("cannot record withdrawal: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*card = *updated
+	return nil
+}
+
+func (s *Service) checkWithdrawalLimits(cards CardRepository, card *Card, amount Money) error {
+	perWithdrawal, daily, err := s.WithdrawalLimits(card)
+	if err != nil {
+		return err
+	}
+
+	if perWithdrawal != nil && amount.Amount > perWithdrawal.Amount {
+		return &WithdrawalLimitError{Amount: amount, Limit: *perWithdrawal}
+	}
+	if daily == nil {
+		return nil
+	}
+
+	entries, err := cards.Entries(EntryQuery{
+		AccountID: card.AccountID,
+		Kind:      KindWithdrawal,
+		Entry:     EntryDebit,
+		Since:     s.Now().UTC().Add(-WithdrawalWindow),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot load recent withdrawals: %w", err)
+	}
+	var withdrawn int64
+	for _, entry := range entries {
+		withdrawn += entry.Amount
+	}
+
+	remaining := max(daily.Amount-withdrawn, 0)
+	if amount.Amount > remaining {
+		return &WithdrawalLimitError{
+			Amount:    amount,
+			Limit:     *daily,
+			Daily:     true,
+			Remaining: Money{Amount: remaining, Currency: amount.Currency},
+		}
+	}
+	return nil
+}
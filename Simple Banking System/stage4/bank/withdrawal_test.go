@@ -0,0 +1,102 @@
+package bank
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestWithdrawalLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.WithdrawalLimit = big.NewRat(5, 1)
+	config.DailyWithdrawalLimit = big.NewRat(50, 1)
+	service := newTestService(t, config)
+	card := createTestCard(t, service.cards, "4000003972196502", 10000)
+	other := createTestCard(t, service.cards, "4000000000000010", 10000)
+
+	// The card overrides the default per-withdrawal limit and keeps the default daily one.
+	own := usd(800)
+	if err := service.SetWithdrawalLimits(card, &own, nil); err != nil {
+		t.Fatalf("cannot set withdrawal limits: %v", err)
+	}
+	if perWithdrawal, daily, err := service.WithdrawalLimits(card); err != nil || *perWithdrawal != usd(800) || *daily != usd(5000) {
+		t.Errorf("limits of the card are %v and %v, %v, want 8.00 USD and 50.00 USD", perWithdrawal, daily, err)
+	}
+
+	for _, test := range []struct {
+		card   *Card
+		amount int64
+		limit  int64
+	}{
+		// Amounts up to the limit are allowed, and one cent more is not.
+		{other, 500, 0},
+		{other, 501, 500},
+		{card, 800, 0},
+		{card, 801, 800},
+	} {
+		err := service.Withdraw(test.card, usd(test.amount))
+		var limitErr *WithdrawalLimitError
+		switch {
+		case test.limit == 0 && err != nil:
+			t.Errorf("withdrawing %v from %s failed: %v", usd(test.amount), test.card.Number, err)
+		case test.limit != 0 && (!errors.As(err, &limitErr) || limitErr.Daily || limitErr.Limit != usd(test.limit)):
+			t.Errorf("withdrawing %v from %s failed with %v, want the limit of %v per withdrawal",
+				usd(test.amount), test.card.Number, err, usd(test.limit))
+		}
+	}
+	if balance, _ := service.Balance(card.Number); balance != usd(9200) {
+		t.Errorf("card holds %v, want only the allowed withdrawal taken out", balance)
+	}
+
+	// Clearing the override brings back the default.
+	if err := service.SetWithdrawalLimits(card, nil, nil); err != nil {
+		t.Fatalf("cannot clear withdrawal limits: %v", err)
+	}
+	if err := service.Withdraw(card, usd(600)); !errors.Is(err, ErrWithdrawalLimit) {
+		t.Errorf("withdrawing over the default limit failed with %v, want %v", err, ErrWithdrawalLimit)
+	}
+	if err := service.SetWithdrawalLimits(card, &Money{Amount: 100, Currency: "EUR"}, nil); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("setting a EUR limit on a USD card failed with %v, want %v", err, ErrCurrencyMismatch)
+	}
+}
+
+func TestDailyWithdrawalLimitWindow(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 9, 0, 0, 0, time.UTC)
+	config := DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	service := newTestService(t, config)
+	card := createTestCard(t, service.cards, "4000003972196502", 10000)
+	daily := usd(1000)
+	if err := service.SetWithdrawalLimits(card, nil, &daily); err != nil {
+		t.Fatalf("cannot set withdrawal limits: %v", err)
+	}
+
+	withdraw := func(amount int64) error {
+		return service.Withdraw(card, usd(amount))
+	}
+	if err := withdraw(600); err != nil {
+		t.Fatalf("withdrawal failed: %v", err)
+	}
+	start := now
+
+	// The window is rolling: a second before it ends the withdrawal still counts, and the
+	// remaining 4.00 is the most that can be withdrawn.
+	now = start.Add(WithdrawalWindow - time.Second)
+	var limitErr *WithdrawalLimitError
+	if err := withdraw(401); !errors.As(err, &limitErr) || !limitErr.Daily || limitErr.Remaining != usd(400) {
+		t.Errorf("withdrawing 4.01 failed with %v, want the daily limit with 4.00 remaining", err)
+	}
+	if err := withdraw(400); err != nil {
+		t.Errorf("cannot withdraw the remaining 4.00: %v", err)
+	}
+
+	// Once the window has passed the first withdrawal no longer counts, but the second does.
+	now = start.Add(WithdrawalWindow)
+	if err := withdraw(700); !errors.Is(err, ErrWithdrawalLimit) {
+		t.Errorf("withdrawing 7.00 failed with %v, want %v", err, ErrWithdrawalLimit)
+	}
+	if err := withdraw(600); err != nil {
+		t.Errorf("cannot withdraw 6.00 once the first withdrawal left the window: %v", err)
+	}
+}
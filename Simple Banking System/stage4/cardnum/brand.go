@@ -0,0 +1,76 @@
+package cardnum
+
+// Brand is the card network a card number belongs to.
+type Brand string
+
+// Brands recognized by BrandOf
+const (
+	Unknown         Brand = ""
+	Visa            Brand = "Visa"
+	Mastercard      Brand = "Mastercard"
+	AmericanExpress Brand = "American Express"
+	Discover        Brand = "Discover"
+	JCB             Brand = "JCB"
+	DinersClub      Brand = "Diners Club"
+	UnionPay        Brand = "UnionPay"
+)
+
+// iinRange is a range of IIN prefixes assigned to a brand: the card numbers starting with a
+// number between Low and High, both having the same number of digits.
+type iinRange struct {
+	Brand Brand
+	Low   int
+	High  int
+}
+
+// iinRanges lists the prefixes of each brand, the more specific ones first since some brands
+// share a leading digit.
+var iinRanges = []iinRange{
+	{Brand: Discover, Low: 6011, High: 6011},
+	{Brand: Discover, Low: 644, High: 649},
+	{Brand: Discover, Low: 65, High: 65},
+	{Brand: UnionPay, Low: 62, High: 62},
+	{Brand: JCB, Low: 3528, High: 3589},
+	{Brand: DinersClub, Low: 300, High: 305},
+	{Brand: DinersClub, Low: 36, High: 36},
+	{Brand: DinersClub, Low: 38, High: 39},
+	{Brand: AmericanExpress, Low: 34, High: 34},
+	{Brand: AmericanExpress, Low: 37, High: 37},
+	{Brand: Mastercard, Low: 2221, High: 2720},
+	{Brand: Mastercard, Low: 51, High: 55},
+	{Brand: Visa, Low: 4, High: 4},
+}
+
+// BrandOf returns the brand of number by its IIN prefix, or Unknown. It does not validate number.
+func BrandOf(number string) Brand {
+	for _, r := range iinRanges {
+		prefix, ok := leadingNumber(number, digitCount(r.Low))
+		if ok && prefix >= r.Low && prefix <= r.High {
+			return r.Brand
+		}
+	}
+	return Unknown
+}
+
+// leadingNumber returns the number formed by the first n characters of s, if they are digits.
+func leadingNumber(s string, n int) (int, bool) {
+	if len(s) < n {
+		return 0, false
+	}
+	number := 0
+	for i := 0; i < n; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		number = number*10 + int(s[i]-'0')
+	}
+	return number, true
+}
+
+func digitCount(n int) int {
+	count := 1
+	for ; n >= 10; n /= 10 {
+		count++
+	}
+	return count
+}
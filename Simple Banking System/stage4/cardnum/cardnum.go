@@ -0,0 +1,91 @@
+// Package cardnum validates payment card numbers: their digits, their length, their Luhn check
+// digit, and the brand their issuer identification number (IIN) prefix belongs to.
+package cardnum
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Card number lengths accepted by default, as allowed by ISO/IEC 7812
+const (
+	MinLength = 13
+	MaxLength = 19
+)
+
+// Failures reported by Validate and ComputeCheckDigit
+var (
+	ErrNotDigits  = errors.New("card number must only contain digits")
+	ErrLength     = errors.New("card number has an invalid length")
+	ErrCheckDigit = errors.New("card number fails the Luhn check")
+)
+
+// Validator checks card numbers whose length is between MinLength and MaxLength digits.
+type Validator struct {
+	MinLength int
+	MaxLength int
+}
+
+// DefaultValidator is used by Validate.
+var DefaultValidator = Validator{MinLength: MinLength, MaxLength: MaxLength}
+
+// Validate checks number with DefaultValidator.
+func Validate(number string) error {
+	return DefaultValidator.Validate(number)
+}
+
+// Validate checks that number only has digits, that its length is allowed and that its last
+// digit is its Luhn check digit. It fails with ErrNotDigits, ErrLength or ErrCheckDigit.
+func (v Validator) Validate(number string) error {
+	if err := checkDigits(number); err != nil {
+		return err
+	}
+	if len(number) < v.MinLength || len(number) > v.MaxLength {
+		return fmt.Errorf("%w: %d digits, want %d to %d", ErrLength, len(number), v.MinLength, v.MaxLength)
+	}
+
+	payload, checkDigit := number[:len(number)-1], int(number[len(number)-1]-'0')
+	if luhnCheckDigit(payload) != checkDigit {
+		return ErrCheckDigit
+	}
+	return nil
+}
+
+// ComputeCheckDigit returns the Luhn check digit to append to payload, the card number without
+// its last digit. It fails with ErrNotDigits if payload is empty or has anything but digits.
+func ComputeCheckDigit(payload string) (int, error) {
+	if err := checkDigits(payload); err != nil {
+		return 0, err
+	}
+	return luhnCheckDigit(payload), nil
+}
+
+func checkDigits(number string) error {
+	if number == "" {
+		return fmt.Errorf("%w: empty", ErrNotDigits)
+	}
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return fmt.Errorf("%w: %q at position %d", ErrNotDigits, number[i], i+1)
+		}
+	}
+	return nil
+}
+
+// luhnCheckDigit computes the check digit of payload, which must only have digits. Starting
+// from the digit next to the check digit, every other digit is doubled, subtracting 9 from
+// doubles above 9, and the check digit brings the sum of all digits to a multiple of 10.
+func luhnCheckDigit(payload string) int {
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		digit := int(payload[i] - '0')
+		if (len(payload)-i)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,128 @@
+package cardnum
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		number string
+		err    error
+	}{
+		{"4000000000000002", nil},
+		{"4000003524742695", nil},
+		{"4222222222222", nil},
+		{"378282246310005", nil},
+		{"6011111111111117", nil},
+		{"6011000000000000001", nil},
+		{"4000000000000003", ErrCheckDigit},
+		{"4000000000000020", ErrCheckDigit},
+		{"", ErrNotDigits},
+		{"4000 0000 0000 0002", ErrNotDigits},
+		{"400000000000000x", ErrNotDigits},
+		{"-400000000000002", ErrNotDigits},
+		{"0", ErrLength},
+		{"400000000000", ErrLength},
+		{"40000000000000000006", ErrLength},
+	} {
+		if err := Validate(test.number); !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("Validate(%q) = %v, want %v", test.number, err, test.err)
+		}
+	}
+}
+
+func TestValidatorLengths(t *testing.T) {
+	sixteen := Validator{MinLength: 16, MaxLength: 16}
+	if err := sixteen.Validate("4000000000000002"); err != nil {
+		t.Errorf("16-digit number rejected: %v", err)
+	}
+	if err := sixteen.Validate("378282246310005"); !errors.Is(err, ErrLength) {
+		t.Errorf("15-digit number accepted with %v, want %v", err, ErrLength)
+	}
+}
+
+func TestComputeCheckDigit(t *testing.T) {
+	for payload, want := range map[string]int{
+		"400000000000000": 2,
+		"400000352474269": 5,
+		"37828224631000":  5,
+		"7992739871":      3,
+		"0":               0,
+	} {
+		if got, err := ComputeCheckDigit(payload); got != want || err != nil {
+			t.Errorf("ComputeCheckDigit(%q) = %d, %v, want %d", payload, got, err, want)
+		}
+	}
+	for _, payload := range []string{"", "12a4", " 123"} {
+		if _, err := ComputeCheckDigit(payload); !errors.Is(err, ErrNotDigits) {
+			t.Errorf("ComputeCheckDigit(%q) failed with %v, want %v", payload, err, ErrNotDigits)
+		}
+	}
+}
+
+func TestBrandOf(t *testing.T) {
+	for number, want := range map[string]Brand{
+		"4000000000000002":    Visa,
+		"4":                   Visa,
+		"5555555555554444":    Mastercard,
+		"2221000000000009":    Mastercard,
+		"2720990000000007":    Mastercard,
+		"378282246310005":     AmericanExpress,
+		"341111111111111":     AmericanExpress,
+		"6011111111111117":    Discover,
+		"6445644564456445":    Discover,
+		"6500000000000002":    Discover,
+		"6200000000000005":    UnionPay,
+		"3530111333300000":    JCB,
+		"30569309025904":      DinersClub,
+		"36227206271667":      DinersClub,
+		"1234567812345670":    Unknown,
+		"2220990000000000":    Unknown,
+		"":                    Unknown,
+		"x4000000000000002":   Unknown,
+		"6":                   Unknown,
+		"6011000000000000001": Discover,
+	} {
+		if got := BrandOf(number); got != want {
+			t.Errorf("BrandOf(%q) = %q, want %q", number, got, want)
+		}
+	}
+}
+
+func FuzzValidate(f *testing.F) {
+	for _, seed := range []string{"4000000000000002", "", "0", "4000 0000", "\xff", "4000000000000000000000"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, number string) {
+		err := Validate(number)
+		if err != nil && !errors.Is(err, ErrNotDigits) && !errors.Is(err, ErrLength) && !errors.Is(err, ErrCheckDigit) {
+			t.Errorf("Validate(%q) failed with unexpected error %v", number, err)
+		}
+		BrandOf(number)
+	})
+}
+
+func FuzzComputeCheckDigit(f *testing.F) {
+	for _, seed := range []string{"400000000000000", "", "7992739871", "12a"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, payload string) {
+		digit, err := ComputeCheckDigit(payload)
+		if err != nil {
+			return
+		}
+		if digit < 0 || digit > 9 {
+			t.Fatalf("ComputeCheckDigit(%q) = %d, not a digit", payload, digit)
+		}
+
+		number := payload + string(rune('0'+digit))
+		if err := (Validator{MinLength: 1, MaxLength: len(number)}).Validate(number); err != nil {
+			t.Errorf("%q with its check digit fails validation: %v", payload, err)
+		}
+		wrong := payload + string(rune('0'+(digit+1)%10))
+		if err := (Validator{MinLength: 1, MaxLength: len(wrong)}).Validate(wrong); !errors.Is(err, ErrCheckDigit) {
+			t.Errorf("%q with a wrong check digit validated with %v", payload, err)
+		}
+	})
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"stage4/bank"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Subcommands
+const (
+	CreateCommand         = "create"
+	BalanceCommand        = "balance"
+	DepositCommand        = "deposit"
+	TransferCommand       = "transfer"
+	CloseCommand          = "close"
+	RunDueCommand         = "run-due"
+	StatementCommand      = "statement"
+	AccrueInterestCommand = "accrue-interest"
+	InterestRateCommand   = "interest-rate"
+	MigrateCommand        = "migrate"
+
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+)
+
+// Migration messages
+const (
+	MigrateUsage        = "usage: migrate up | down [steps] | status"
+	SchemaVersionMsg    = "Schema version %d, latest known %d\n"
+	SchemaTooNewMsg     = "The database was migrated by a newer version of this program."
+	MigrationAppliedMsg = "%4d  %-30s  applied %s\n"
+	MigrationPendingMsg = "%4d  %-30s  pending\n"
+	MigratedMsg         = "Migrated to schema version %d\n"
+)
+
+// Scheduled transfer messages
+const (
+	ScheduledRunMsg       = "Scheduled transfer %d of %s to %s: done, next %s\n"
+	ScheduledRunFailedMsg = "Scheduled transfer %d of %s to %s: %s, next %s\n"
+	NoDueTransfersMsg     = "No scheduled transfers are due."
+	RunDueFailedMsg       = "The scheduled transfers could not be run."
+)
+
+// Interest messages
+const (
+	InterestPostedMsg     = "Interest of %s earned in %s at %s credited to card %s\n"
+	NoInterestPostedMsg   = "Interest accrued; none was due to be credited."
+	InterestFailedMsg     = "Interest of card %s could not be accrued: %s\n"
+	AccrualFailedMsg      = "Interest could not be accrued."
+	InterestRateMsg       = "Card %s earns %s a year.\n"
+	InterestRateFailedMsg = "The interest rate could not be set."
+
+	// ProductRate resets the interest rate of a card to that of its product.
+	ProductRate = "product"
+)
+
+// Output formats of the subcommands
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// PINVariable is the environment variable the subcommands read the PIN from. When it is unset
+// the PIN is read from the first line of the standard input.
+const PINVariable = "BANK_PIN"
+
+// ErrCommandFailed is returned by RunCommand when the subcommand failed and has reported why.
+var ErrCommandFailed = errors.New("command failed")
+
+// DefaultMigrateDownSteps is how many migrations `migrate down` reverts when not told otherwise.
+const DefaultMigrateDownSteps = 1
+
+// RunCommand runs the subcommand in args.Command, whose first element is its name. The banking
+// subcommands report their results and failures themselves, on the standard output in the format
+// chosen by their -output flag, and then return ErrCommandFailed on failure.
+func RunCommand(args Arguments) error {
+	name, commandArgs := args.Command[0], args.Command[1:]
+	if name == MigrateCommand {
+		return RunMigrate(args.DSN(), commandArgs)
+	}
+
+	run, ok := map[string]func(*Command, []string) error{
+		CreateCommand:         RunCreate,
+		BalanceCommand:        RunBalance,
+		DepositCommand:        RunDeposit,
+		TransferCommand:       RunTransfer,
+		CloseCommand:          RunClose,
+		RunDueCommand:         RunRunDue,
+		StatementCommand:      RunStatement,
+		AccrueInterestCommand: RunAccrueInterest,
+		InterestRateCommand:   RunInterestRate,
+	}[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	cmd := &Command{Flags: flag.NewFlagSet(name, flag.ContinueOnError), arguments: args}
+	cmd.Flags.StringVar(&cmd.Format, "output", OutputText, "Output format: text or json")
+	return run(cmd, commandArgs)
+}
+
+// Command is a banking subcommand being run. It writes the result or the failure of the
+// subcommand in the chosen Format.
+type Command struct {
+	Flags  *flag.FlagSet
+	Format string
+
+	arguments Arguments
+}
+
+// Parse parses the arguments of the subcommand into Flags, which must define all its flags by
+// now, checks that the flags in required were given and opens the banking system. It reports the
+// first problem with the arguments it finds.
+func (c *Command) Parse(args []string, required ...string) (*BankingSystem, error) {
+	if err := c.Flags.Parse(args); err != nil {
+		// The flag package has already printed err and the usage of the subcommand.
+		if c.Format == OutputJSON {
+			return nil, c.report(err, "")
+		}
+		return nil, ErrCommandFailed
+	}
+
+	if c.Format != OutputText && c.Format != OutputJSON {
+		c.Format = OutputText
+		err := fmt.Errorf("the -output flag must be %s or %s", OutputText, OutputJSON)
+		return nil, c.report(err, err.Error())
+	}
+	given := map[string]bool{}
+	c.Flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, name := range required {
+		if !given[name] {
+			err := fmt.Errorf("the -%s flag is required", name)
+			return nil, c.report(err, err.Error())
+		}
+	}
+	if c.Flags.NArg() != 0 {
+		err := fmt.Errorf("unexpected arguments: %s", strings.Join(c.Flags.Args(), " "))
+		return nil, c.report(err, err.Error())
+	}
+
+	cards, err := bank.OpenRepository(c.arguments.DSN())
+	if err != nil {
+		return nil, c.report(err, err.Error())
+	}
+	return NewBankingSystem(bank.NewService(cards, c.arguments.Config), c.arguments.Currency, os.Stdin, os.Stdout), nil
+}
+
+// Result writes v as JSON, or calls text to display it.
+func (c *Command) Result(v any, text func()) error {
+	if c.Format == OutputJSON {
+		return json.NewEncoder(os.Stdout).Encode(v)
+	}
+	text()
+	return nil
+}
+
+// Fail reports err, described by fallback when the menu has no message for it, and returns
+// ErrCommandFailed.
+func (c *Command) Fail(err error, fallback string) error {
+	if c.Format == OutputJSON {
+		return c.report(err, "")
+	}
+	return c.report(err, errorMessage(err, fallback))
+}
+
+// report reports err, or message in the text format, and returns ErrCommandFailed.
+func (c *Command) report(err error, message string) error {
+	if c.Format == OutputJSON {
+		json.NewEncoder(os.Stdout).Encode(ErrorResponse{Error: err.Error()})
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	return ErrCommandFailed
+}
+
+// ReadPIN returns the PIN from the PINVariable environment variable, or else from the first line
+// of the input of bs.
+func ReadPIN(bs *BankingSystem) (string, error) {
+	if pin, ok := os.LookupEnv(PINVariable); ok {
+		return pin, nil
+	}
+
+	pin, err := bs.input.ReadLine()
+	if err != nil {
+		return "", fmt.Errorf("cannot read the PIN from %s or the standard input: %v", PINVariable, err)
+	}
+	return pin, nil
+}
+
+// Authenticate logs into the card with the given number with the PIN given by ReadPIN.
+func (c *Command) Authenticate(bs *BankingSystem, cardNumber string) (*bank.Card, error) {
+	pin, err := ReadPIN(bs)
+	if err != nil {
+		return nil, c.report(err, err.Error())
+	}
+
+	card, err := bs.service.Authenticate(cardNumber, pin)
+	if err != nil {
+		return nil, c.Fail(err, WrongCredentialsMsg)
+	}
+	return card, nil
+}
+
+func balanceResponse(card *bank.Card) BalanceResponse {
+	return BalanceResponse{Number: card.Number, Balance: card.Money().Decimal(), Currency: card.Currency}
+}
+
+// RunCreate creates a card: create [-currency EUR] [-product P].
+func RunCreate(cmd *Command, args []string) error {
+	currency := cmd.Flags.String("currency", cmd.arguments.Currency, "ISO 4217 currency of the card")
+	product := cmd.Flags.String("product", "", "Issuer profile of the card (default the first one)")
+	bs, err := cmd.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	card, pin, err := bs.service.CreateAccount(*currency, *product)
+	if err != nil {
+		return cmd.Fail(err, CardFailedMsg)
+	}
+
+	return cmd.Result(NewCardResponse(card, pin), func() {
+		fmt.Println(CardCreatedMsg)
+		fmt.Printf(CardNumberMsg, card.Number)
+		fmt.Printf(CardPINMsg, pin)
+	})
+}
+
+// RunBalance displays the balance of a card: balance -card N.
+func RunBalance(cmd *Command, args []string) error {
+	cardNumber := cmd.Flags.String("card", "", "Card number")
+	bs, err := cmd.Parse(args, "card")
+	if err != nil {
+		return err
+	}
+
+	card, err := cmd.Authenticate(bs, *cardNumber)
+	if err != nil {
+		return err
+	}
+
+	return cmd.Result(balanceResponse(card), func() {
+		fmt.Printf(BalanceMsg+"\n", card.Money())
+	})
+}
+
+// RunDeposit adds income to a card: deposit -card N -amount X.
+func RunDeposit(cmd *Command, args []string) error {
+	cardNumber := cmd.Flags.String("card", "", "Card number")
+	amount := cmd.Flags.String("amount", "", "Amount to deposit, in the currency of the card")
+	bs, err := cmd.Parse(args, "card", "amount")
+	if err != nil {
+		return err
+	}
+
+	card, err := cmd.Authenticate(bs, *cardNumber)
+	if err != nil {
+		return err
+	}
+	income, err := bank.ParseMoney(*amount, card.Currency)
+	if err != nil {
+		return cmd.Fail(err, AmountFormatMsg)
+	}
+	if err := bs.service.Deposit(card, income); err != nil {
+		return cmd.Fail(err, IncomeFailedMsg)
+	}
+
+	return cmd.Result(balanceResponse(card), func() {
+		fmt.Println(IncomeAddedMsg)
+	})
+}
+
+// RunTransfer moves money between cards: transfer -from N -to M -amount X.
+func RunTransfer(cmd *Command, args []string) error {
+	from := cmd.Flags.String("from", "", "Card number to transfer from")
+	to := cmd.Flags.String("to", "", "Card number to transfer to")
+	amount := cmd.Flags.String("amount", "", "Amount to transfer, in the currency of the -from card")
+	bs, err := cmd.Parse(args, "from", "to", "amount")
+	if err != nil {
+		return err
+	}
+
+	card, err := cmd.Authenticate(bs, *from)
+	if err != nil {
+		return err
+	}
+	transferAmount, err := bank.ParseMoney(*amount, card.Currency)
+	if err != nil {
+		return cmd.Fail(err, AmountFormatMsg)
+	}
+	if err := bs.service.Transfer(card, *to, transferAmount); err != nil {
+		return cmd.Fail(err, TransferFailedMsg)
+	}
+
+	return cmd.Result(balanceResponse(card), func() {
+		fmt.Println(TransferSuccessfulMsg)
+	})
+}
+
+// RunClose closes a card: close -card N [-payout M] [-reason R].
+func RunClose(cmd *Command, args []string) error {
+	cardNumber := cmd.Flags.String("card", "", "Card number")
+	payout := cmd.Flags.String("payout", "", "Card number receiving the remaining balance")
+	reason := cmd.Flags.String("reason", CloseReasonCardHolder, "Why the card is closed")
+	bs, err := cmd.Parse(args, "card")
+	if err != nil {
+		return err
+	}
+
+	card, err := cmd.Authenticate(bs, *cardNumber)
+	if err != nil {
+		return err
+	}
+	statement, err := bs.service.Close(card, bank.CloseRequest{Reason: *reason, PayoutCardNumber: *payout})
+	if err != nil {
+		return cmd.Fail(err, CloseAccountFailedMsg)
+	}
+
+	return cmd.Result(NewStatementResponse(statement), func() {
+		bs.DisplayStatement(statement)
+		fmt.Println(CloseAccountMsg)
+	})
+}
+
+// ScheduledRunResponse describes an attempt at a scheduled transfer; Error is empty when the money
+// was transferred. NextRunAt is omitted once the transfer is no longer active.
+type ScheduledRunResponse struct {
+	ID        uint       `json:"id"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	Amount    string     `json:"amount"`
+	Currency  string     `json:"currency"`
+	Schedule  string     `json:"schedule"`
+	Status    string     `json:"status"`
+	NextRunAt *time.Time `json:"nextRunAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// NewScheduledRunResponse describes run.
+func NewScheduledRunResponse(run bank.ScheduledRun) ScheduledRunResponse {
+	transfer := run.Transfer
+	response := ScheduledRunResponse{
+		ID:       transfer.ID,
+		From:     transfer.SenderNumber,
+		To:       transfer.RecipientNumber,
+		Amount:   transfer.Money().Decimal(),
+		Currency: transfer.Currency,
+		Schedule: transfer.Schedule,
+		Status:   transfer.Status,
+	}
+	if transfer.Status == bank.ScheduledActive {
+		response.NextRunAt = &transfer.NextRunAt
+	}
+	if run.Err != nil {
+		response.Error = run.Err.Error()
+	}
+	return response
+}
+
+// RunRunDue executes the scheduled transfers that are due: run-due. It is meant to be run
+// periodically, e.g. by cron; runs missed in between are caught up.
+func RunRunDue(cmd *Command, args []string) error {
+	bs, err := cmd.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	runs, err := bs.service.RunDueTransfers()
+	if err != nil {
+		return cmd.Fail(err, RunDueFailedMsg)
+	}
+
+	responses := make([]ScheduledRunResponse, 0, len(runs))
+	for _, run := range runs {
+		responses = append(responses, NewScheduledRunResponse(run))
+	}
+	return cmd.Result(responses, func() {
+		if len(runs) == 0 {
+			fmt.Println(NoDueTransfersMsg)
+		}
+		for _, run := range runs {
+			transfer := run.Transfer
+			next := transfer.Status
+			if next == bank.ScheduledActive {
+				next = transfer.NextRunAt.Format(time.DateTime)
+			}
+			if run.Err != nil {
+				fmt.Printf(ScheduledRunFailedMsg, transfer.ID, transfer.Money(), transfer.RecipientNumber,
+					errorMessage(run.Err, run.Err.Error()), next)
+			} else {
+				fmt.Printf(ScheduledRunMsg, transfer.ID, transfer.Money(), transfer.RecipientNumber, next)
+			}
+		}
+	})
+}
+
+// RunStatement displays the monthly statement of a card: statement -card N [-month 2024-01].
+func RunStatement(cmd *Command, args []string) error {
+	cardNumber := cmd.Flags.String("card", "", "Card number")
+	monthFlag := cmd.Flags.String("month", "", "Month of the statement, in UTC, the current one by default")
+	bs, err := cmd.Parse(args, "card")
+	if err != nil {
+		return err
+	}
+	if *monthFlag == "" {
+		*monthFlag = bs.service.Now().UTC().Format(StatementMonthLayout)
+	}
+
+	month, err := time.Parse(StatementMonthLayout, *monthFlag)
+	if err != nil {
+		err = fmt.Errorf("the -month flag must look like %s", StatementMonthLayout)
+		return cmd.report(err, err.Error())
+	}
+	card, err := cmd.Authenticate(bs, *cardNumber)
+	if err != nil {
+		return err
+	}
+	statement, err := bs.service.MonthlyStatement(card, month)
+	if err != nil {
+		return cmd.Fail(err, StatementFailedMsg)
+	}
+
+	return cmd.Result(NewMonthlyStatementResponse(statement), func() {
+		bs.DisplayMonthlyStatement(statement)
+	})
+}
+
+// InterestPostingResponse describes interest credited to a card at the end of Month, or, when
+// Error is set, a card whose interest could not be accrued.
+type InterestPostingResponse struct {
+	Number   string `json:"number"`
+	Month    string `json:"month,omitempty"`
+	Interest string `json:"interest,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Rate     string `json:"rate,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewInterestPostingResponse describes posting.
+func NewInterestPostingResponse(posting bank.InterestPosting) InterestPostingResponse {
+	return InterestPostingResponse{
+		Number:   posting.CardNumber,
+		Month:    posting.Month.Format(StatementMonthLayout),
+		Interest: posting.Interest.Decimal(),
+		Currency: posting.Interest.Currency,
+		Rate:     posting.Rate.String(),
+	}
+}
+
+// NewInterestFailureResponse describes failure.
+func NewInterestFailureResponse(failure bank.InterestFailure) InterestPostingResponse {
+	return InterestPostingResponse{Number: failure.CardNumber, Error: failure.Err.Error()}
+}
+
+// RunAccrueInterest accrues the interest of the cards and credits it at the end of each month:
+// accrue-interest. It is meant to be run daily, e.g. by cron; days missed in between are caught
+// up.
+func RunAccrueInterest(cmd *Command, args []string) error {
+	bs, err := cmd.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	postings, failures, err := bs.service.AccrueInterest()
+	if err != nil {
+		return cmd.Fail(err, AccrualFailedMsg)
+	}
+
+	responses := make([]InterestPostingResponse, 0, len(postings)+len(failures))
+	for _, posting := range postings {
+		responses = append(responses, NewInterestPostingResponse(posting))
+	}
+	for _, failure := range failures {
+		responses = append(responses, NewInterestFailureResponse(failure))
+	}
+	return cmd.Result(responses, func() {
+		if len(postings) == 0 && len(failures) == 0 {
+			fmt.Println(NoInterestPostedMsg)
+		}
+		for _, posting := range postings {
+			fmt.Printf(InterestPostedMsg, posting.Interest, posting.Month.Format(StatementMonthLayout), posting.Rate, posting.CardNumber)
+		}
+		for _, failure := range failures {
+			fmt.Printf(InterestFailedMsg, failure.CardNumber, errorMessage(failure.Err, failure.Err.Error()))
+		}
+	})
+}
+
+// InterestRateResponse is the rate a card earns; Own tells whether it is the rate of the card
+// rather than that of its product.
+type InterestRateResponse struct {
+	Number string `json:"number"`
+	Rate   string `json:"rate"`
+	Own    bool   `json:"own"`
+}
+
+// RunInterestRate sets the interest rate of a card: interest-rate -card N -rate 1.5, or -rate
+// product for the rate of its product. It is an administrative command and reads no PIN.
+func RunInterestRate(cmd *Command, args []string) error {
+	cardNumber := cmd.Flags.String("card", "", "Card number")
+	rateFlag := cmd.Flags.String("rate", "", "Annual interest rate in percent, or "+ProductRate)
+	bs, err := cmd.Parse(args, "card", "rate")
+	if err != nil {
+		return err
+	}
+
+	var rate *bank.InterestRate
+	if *rateFlag != ProductRate {
+		parsed, err := bank.ParseInterestRate(*rateFlag)
+		if err != nil {
+			return cmd.Fail(err, InterestRateFormatMsg)
+		}
+		rate = &parsed
+	}
+	card, err := bs.service.GetCard(*cardNumber)
+	if err != nil {
+		return cmd.Fail(err, InterestRateFailedMsg)
+	}
+	if err := bs.service.SetInterestRate(card, rate); err != nil {
+		return cmd.Fail(err, InterestRateFailedMsg)
+	}
+	effective, err := bs.service.InterestRate(card)
+	if err != nil {
+		return cmd.Fail(err, InterestRateFailedMsg)
+	}
+
+	return cmd.Result(InterestRateResponse{Number: card.Number, Rate: effective.String(), Own: rate != nil}, func() {
+		fmt.Printf(InterestRateMsg, card.Number, effective)
+	})
+}
+
+// RunMigrate applies, reverts or lists the schema migrations of the database described by dsn.
+func RunMigrate(dsn string, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(MigrateUsage)
+	}
+
+	db, err := bank.OpenDatabase(dsn)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == MigrateUp && len(args) == 1:
+		err = bank.MigrateUp(db)
+	case args[0] == MigrateDown:
+		steps := DefaultMigrateDownSteps
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("the number of steps must be a positive integer")
+			}
+		}
+		err = bank.MigrateDown(db, steps)
+	case args[0] == MigrateStatus && len(args) == 1:
+		return DisplayMigrationStatus(db)
+	default:
+		return errors.New(MigrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := bank.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(MigratedMsg, version)
+	return nil
+}
+
+// DisplayMigrationStatus prints the schema version of db and whether each known migration has
+// been applied to it.
+func DisplayMigrationStatus(db *gorm.DB) error {
+	version, err := bank.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	statuses, err := bank.MigrationStatuses(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(SchemaVersionMsg, version, bank.LatestSchemaVersion())
+	if version > bank.LatestSchemaVersion() {
+		fmt.Println(SchemaTooNewMsg)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			fmt.Printf(MigrationAppliedMsg, status.Version, status.Name, status.AppliedAt.Format(time.DateTime))
+		} else {
+			fmt.Printf(MigrationPendingMsg, status.Version, status.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"stage4/bank"
+	"strings"
+	"testing"
+	"time"
+)
+
+// commandRun is what a subcommand wrote and returned.
+type commandRun struct {
+	stdout, stderr string
+	err            error
+}
+
+// runCommand runs the subcommand in args against the database in file, with stdin as its
+// standard input, and captures its standard output and error.
+func runCommand(t *testing.T, file, stdin string, args ...string) commandRun {
+	t.Helper()
+	return runConfiguredCommand(t, file, bank.DefaultConfig(), stdin, args...)
+}
+
+// runConfiguredCommand is runCommand with the banking policies of config.
+func runConfiguredCommand(t *testing.T, file string, config bank.Config, stdin string, args ...string) commandRun {
+	t.Helper()
+
+	dir := t.TempDir()
+	open := func(name, content string) *os.File {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("cannot create %s: %v", name, err)
+		}
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatalf("cannot write %s: %v", name, err)
+		}
+		f.Seek(0, 0)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	stdinFile, stdoutFile, stderrFile := open("stdin", stdin), open("stdout", ""), open("stderr", "")
+
+	savedStdin, savedStdout, savedStderr := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = stdinFile, stdoutFile, stderrFile
+	err := RunCommand(Arguments{
+		DatabaseFileName: file,
+		Currency:         bank.DefaultCurrency,
+		Config:           config,
+		Command:          args,
+	})
+	os.Stdin, os.Stdout, os.Stderr = savedStdin, savedStdout, savedStderr
+
+	read := func(f *os.File) string {
+		content, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatalf("cannot read %s: %v", f.Name(), err)
+		}
+		return string(content)
+	}
+	return commandRun{stdout: read(stdoutFile), stderr: read(stderrFile), err: err}
+}
+
+// createCommandCard creates a card with the create subcommand and returns it with its PIN.
+func createCommandCard(t *testing.T, file string) CardResponse {
+	t.Helper()
+
+	run := runCommand(t, file, "", CreateCommand, "-output", OutputJSON)
+	if run.err != nil {
+		t.Fatalf("create failed: %v %s", run.err, run.stderr)
+	}
+	var card CardResponse
+	if err := json.Unmarshal([]byte(run.stdout), &card); err != nil {
+		t.Fatalf("cannot decode the created card %q: %v", run.stdout, err)
+	}
+	return card
+}
+
+func TestCommandCreate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+
+	run := runCommand(t, file, "", CreateCommand, "-currency", "EUR")
+	if run.err != nil {
+		t.Fatalf("create failed: %v %s", run.err, run.stderr)
+	}
+	lines := strings.Split(run.stdout, "\n")
+	if len(lines) < 5 {
+		t.Fatalf("unexpected output %q", run.stdout)
+	}
+	number, pin := lines[2], lines[4]
+	if want := CardCreatedMsg + "\n" + fmt.Sprintf(CardNumberMsg, number) + fmt.Sprintf(CardPINMsg, pin); run.stdout != want {
+		t.Fatalf("create wrote %q, want %q", run.stdout, want)
+	}
+
+	t.Setenv(PINVariable, pin)
+	run = runCommand(t, file, "", BalanceCommand, "-card", number)
+	if want := fmt.Sprintf(BalanceMsg+"\n", "0.00 EUR"); run.err != nil || run.stdout != want {
+		t.Errorf("balance of the created card wrote %q and returned %v, want %q", run.stdout, run.err, want)
+	}
+
+	card := createCommandCard(t, file)
+	if card.Number == "" || card.PIN == "" || card.Currency != bank.DefaultCurrency {
+		t.Errorf("created card %+v", card)
+	}
+
+	run = runCommand(t, file, "", CreateCommand, "-product", "platinum")
+	if !errors.Is(run.err, ErrCommandFailed) || run.stderr != UnknownProductMsg+"\n" {
+		t.Errorf("create of an unknown product wrote %q and returned %v", run.stderr, run.err)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+	from, to := createCommandCard(t, file), createCommandCard(t, file)
+	balance := func(card CardResponse, amount string) string {
+		response, _ := json.Marshal(BalanceResponse{Number: card.Number, Balance: amount, Currency: card.Currency})
+		return string(response) + "\n"
+	}
+	failure := func(err string) string {
+		response, _ := json.Marshal(ErrorResponse{Error: err})
+		return string(response) + "\n"
+	}
+
+	for _, test := range []struct {
+		name string
+		// pin is given through PINVariable unless it is empty, and stdin is the standard input.
+		pin, stdin string
+		args       []string
+		wantOut    string
+		wantErrOut string
+		failed     bool
+		// check checks the standard output instead of wantOut.
+		check func(t *testing.T, stdout string)
+	}{
+		{
+			name:    "deposit",
+			pin:     from.PIN,
+			args:    []string{DepositCommand, "-card", from.Number, "-amount", "100"},
+			wantOut: IncomeAddedMsg + "\n",
+		},
+		{
+			name:    "balance with the PIN on the standard input",
+			stdin:   from.PIN + "\n",
+			args:    []string{BalanceCommand, "-card", from.Number},
+			wantOut: fmt.Sprintf(BalanceMsg+"\n", "100.00 USD"),
+		},
+		{
+			name:    "transfer in JSON",
+			pin:     from.PIN,
+			args:    []string{TransferCommand, "-from", from.Number, "-to", to.Number, "-amount", "30.50", "-output", OutputJSON},
+			wantOut: balance(from, "69.50"),
+		},
+		{
+			name:       "transfer of more than the balance",
+			pin:        from.PIN,
+			args:       []string{TransferCommand, "-from", from.Number, "-to", to.Number, "-amount", "70"},
+			wantErrOut: NotEnoughMoneyMsg + "\n",
+			failed:     true,
+		},
+		{
+			name:    "balance in JSON",
+			pin:     to.PIN,
+			args:    []string{BalanceCommand, "-card", to.Number, "-output", OutputJSON},
+			wantOut: balance(to, "30.50"),
+		},
+		{
+			name:       "wrong PIN",
+			pin:        "0000",
+			args:       []string{BalanceCommand, "-card", to.Number},
+			wantErrOut: WrongCredentialsMsg + "\n",
+			failed:     true,
+		},
+		{
+			name:    "wrong PIN in JSON",
+			pin:     "0000",
+			args:    []string{BalanceCommand, "-card", to.Number, "-output", OutputJSON},
+			wantOut: failure(bank.ErrWrongCredentials.Error()),
+			failed:  true,
+		},
+		{
+			name:       "no PIN",
+			args:       []string{BalanceCommand, "-card", to.Number},
+			wantErrOut: "cannot read the PIN from " + PINVariable + " or the standard input: EOF\n",
+			failed:     true,
+		},
+		{
+			name:       "invalid amount",
+			pin:        from.PIN,
+			args:       []string{DepositCommand, "-card", from.Number, "-amount", "ten"},
+			wantErrOut: AmountFormatMsg + "\n",
+			failed:     true,
+		},
+		// The first problem with the arguments is the one reported.
+		{
+			name:       "missing flag",
+			args:       []string{DepositCommand, "-card", from.Number, "extra"},
+			wantErrOut: "the -amount flag is required\n",
+			failed:     true,
+		},
+		{
+			name:       "unexpected argument",
+			args:       []string{BalanceCommand, "-card", from.Number, "extra"},
+			wantErrOut: "unexpected arguments: extra\n",
+			failed:     true,
+		},
+		{
+			name:       "unknown output format",
+			args:       []string{BalanceCommand, "-output", "xml", "extra"},
+			wantErrOut: "the -output flag must be text or json\n",
+			failed:     true,
+		},
+		{
+			name:    "unknown flag in JSON",
+			args:    []string{BalanceCommand, "-output", OutputJSON, "-bogus"},
+			wantOut: failure("flag provided but not defined: -bogus"),
+			failed:  true,
+		},
+		{
+			name: "close with payout",
+			pin:  to.PIN,
+			args: []string{CloseCommand, "-card", to.Number, "-payout", from.Number, "-output", OutputJSON},
+			check: func(t *testing.T, stdout string) {
+				var statement StatementResponse
+				if err := json.Unmarshal([]byte(stdout), &statement); err != nil {
+					t.Fatalf("cannot decode the statement %q: %v", stdout, err)
+				}
+				if statement.Number != to.Number || statement.Payout != "30.50" || statement.PayoutCard != from.Number {
+					t.Errorf("closing statement %+v", statement)
+				}
+			},
+		},
+		{
+			name:    "closed card",
+			pin:     to.PIN,
+			args:    []string{BalanceCommand, "-card", to.Number, "-output", OutputJSON},
+			wantOut: failure(bank.ErrAccountClosed.Error()),
+			failed:  true,
+		},
+		{
+			name:    "balance after the payout",
+			pin:     from.PIN,
+			args:    []string{BalanceCommand, "-card", from.Number},
+			wantOut: fmt.Sprintf(BalanceMsg+"\n", "100.00 USD"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(PINVariable, test.pin)
+			if test.pin == "" {
+				os.Unsetenv(PINVariable)
+			}
+
+			run := runCommand(t, file, test.stdin, test.args...)
+			if test.failed != errors.Is(run.err, ErrCommandFailed) {
+				t.Fatalf("%v returned %v, want failure %t", test.args, run.err, test.failed)
+			}
+			if test.check != nil {
+				test.check(t, run.stdout)
+			} else if run.stdout != test.wantOut {
+				t.Errorf("%v wrote %q, want %q", test.args, run.stdout, test.wantOut)
+			}
+			if test.wantErrOut != "" && run.stderr != test.wantErrOut {
+				t.Errorf("%v wrote %q to the standard error, want %q", test.args, run.stderr, test.wantErrOut)
+			}
+		})
+	}
+}
+
+func TestCommandRunDue(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+	from, to := createCommandCard(t, file), createCommandCard(t, file)
+	t.Setenv(PINVariable, from.PIN)
+	if run := runCommand(t, file, "", DepositCommand, "-card", from.Number, "-amount", "50"); run.err != nil {
+		t.Fatalf("deposit failed: %v %s", run.err, run.stderr)
+	}
+
+	// Transfers are scheduled through the menu, which the service stands for here.
+	cards, err := bank.OpenRepository("sqlite:" + file)
+	if err != nil {
+		t.Fatalf("cannot open the database: %v", err)
+	}
+	service := bank.NewService(cards, bank.DefaultConfig())
+	sender, err := cards.FindByNumber(from.Number)
+	if err != nil {
+		t.Fatalf("cannot find the sender: %v", err)
+	}
+	start := time.Now().UTC()
+	schedule := func(amount int64, schedule string) *bank.ScheduledTransfer {
+		transfer, err := service.ScheduleTransfer(sender, bank.ScheduleRequest{
+			RecipientCardNumber: to.Number,
+			Amount:              bank.Money{Amount: amount, Currency: bank.DefaultCurrency},
+			Schedule:            schedule,
+			StartAt:             start,
+		})
+		if err != nil {
+			t.Fatalf("cannot schedule transfer: %v", err)
+		}
+		return transfer
+	}
+	daily, once := schedule(1000, bank.ScheduleDaily), schedule(100000, bank.ScheduleOnce)
+
+	run := runCommand(t, file, "", RunDueCommand, "-output", OutputJSON)
+	if run.err != nil {
+		t.Fatalf("run-due failed: %v %s", run.err, run.stderr)
+	}
+	var responses []ScheduledRunResponse
+	if err := json.Unmarshal([]byte(run.stdout), &responses); err != nil || len(responses) != 2 {
+		t.Fatalf("run-due wrote %q, want both transfers", run.stdout)
+	}
+	for _, response := range responses {
+		switch response.ID {
+		case daily.ID:
+			if response.Error != "" || response.Amount != "10.00" || response.NextRunAt == nil || !response.NextRunAt.Equal(start.AddDate(0, 0, 1)) {
+				t.Errorf("daily run is %+v, want it done and next due tomorrow", response)
+			}
+		case once.ID:
+			// A failed run stays active until its retries run out.
+			if response.Status != bank.ScheduledActive || !strings.Contains(response.Error, bank.ErrInsufficientFunds.Error()) {
+				t.Errorf("one-off run is %+v, want it to fail for insufficient funds", response)
+			}
+		default:
+			t.Errorf("unexpected run %+v", response)
+		}
+	}
+
+	t.Setenv(PINVariable, to.PIN)
+	run = runCommand(t, file, "", BalanceCommand, "-card", to.Number)
+	if want := fmt.Sprintf(BalanceMsg+"\n", "10.00 USD"); run.stdout != want {
+		t.Errorf("recipient balance is %q, want %q", run.stdout, want)
+	}
+
+	run = runCommand(t, file, "", RunDueCommand)
+	if run.err != nil || run.stdout != NoDueTransfersMsg+"\n" {
+		t.Errorf("second run-due wrote %q and returned %v, want nothing due", run.stdout, run.err)
+	}
+}
+
+func TestCommandInterest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+	now := time.Date(2030, time.January, 30, 12, 0, 0, 0, time.UTC)
+	config := bank.DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	run := func(args ...string) commandRun {
+		t.Helper()
+		return runConfiguredCommand(t, file, config, "", args...)
+	}
+
+	created := run(CreateCommand, "-output", OutputJSON)
+	var card CardResponse
+	if err := json.Unmarshal([]byte(created.stdout), &card); err != nil {
+		t.Fatalf("cannot decode the created card %q: %v", created.stdout, err)
+	}
+	t.Setenv(PINVariable, card.PIN)
+	if deposit := run(DepositCommand, "-card", card.Number, "-amount", "1000"); deposit.err != nil {
+		t.Fatalf("deposit failed: %v %s", deposit.err, deposit.stderr)
+	}
+
+	for _, test := range []struct {
+		args       []string
+		wantOut    string
+		wantErrOut string
+	}{
+		{[]string{InterestRateCommand, "-card", card.Number, "-rate", "3.65"}, fmt.Sprintf(InterestRateMsg, card.Number, "3.65%"), ""},
+		{[]string{InterestRateCommand, "-card", card.Number, "-rate", "150"}, "", InterestRateFormatMsg + "\n"},
+		{[]string{InterestRateCommand, "-card", "4000000000000002", "-rate", "1"}, "", CardNotFoundMsg + "\n"},
+		{[]string{StatementCommand, "-card", card.Number, "-month", "January"}, "", "the -month flag must look like 2006-01\n"},
+	} {
+		got := run(test.args...)
+		if test.wantErrOut != "" && (!errors.Is(got.err, ErrCommandFailed) || got.stderr != test.wantErrOut) {
+			t.Errorf("%v wrote %q to the standard error and returned %v, want %q", test.args, got.stderr, got.err, test.wantErrOut)
+		}
+		if got.stdout != test.wantOut {
+			t.Errorf("%v wrote %q, want %q", test.args, got.stdout, test.wantOut)
+		}
+	}
+
+	// 1000.00 at 3.65% earns 0.10 a day. The first run accrues January 31, the day before it.
+	now = time.Date(2030, time.February, 1, 6, 0, 0, 0, time.UTC)
+	accrued := run(AccrueInterestCommand, "-output", OutputJSON)
+	var postings []InterestPostingResponse
+	if err := json.Unmarshal([]byte(accrued.stdout), &postings); accrued.err != nil || err != nil {
+		t.Fatalf("accrue-interest wrote %q and returned %v", accrued.stdout, accrued.err)
+	}
+	want := InterestPostingResponse{Number: card.Number, Month: "2030-01", Interest: "0.10", Currency: bank.DefaultCurrency, Rate: "3.65%"}
+	if len(postings) != 1 || postings[0] != want {
+		t.Errorf("accrue-interest posted %+v, want %+v", postings, want)
+	}
+	if again := run(AccrueInterestCommand); again.err != nil || again.stdout != NoInterestPostedMsg+"\n" {
+		t.Errorf("second accrue-interest wrote %q and returned %v", again.stdout, again.err)
+	}
+
+	// The statement is of the month of the clock unless one is given.
+	statement := run(StatementCommand, "-card", card.Number)
+	for _, want := range []string{
+		fmt.Sprintf(MonthlyStatementMsg, card.Number, "February 2030", "1000.00 USD"),
+		fmt.Sprintf(MonthlyTotalsMsg, "0.10 USD", "0.10 USD", "0.00 USD", "1000.10 USD"),
+	} {
+		if statement.err != nil || !strings.Contains(statement.stdout, want) {
+			t.Errorf("statement wrote %q and returned %v, want it to contain %q", statement.stdout, statement.err, want)
+		}
+	}
+	statement = run(StatementCommand, "-card", card.Number, "-month", "2030-01", "-output", OutputJSON)
+	var january MonthlyStatementResponse
+	if err := json.Unmarshal([]byte(statement.stdout), &january); err != nil || january.Month != "2030-01" ||
+		january.Opening != "0.00" || january.Closing != "1000.00" || len(january.Entries) != 1 {
+		t.Errorf("statement of January is %q, %v", statement.stdout, err)
+	}
+
+	reset := run(InterestRateCommand, "-card", card.Number, "-rate", ProductRate, "-output", OutputJSON)
+	var rate InterestRateResponse
+	if err := json.Unmarshal([]byte(reset.stdout), &rate); err != nil || rate != (InterestRateResponse{Number: card.Number, Rate: "0.00%"}) {
+		t.Errorf("resetting the rate wrote %q, %v", reset.stdout, err)
+	}
+}
+
+func TestCommandUnknownFlag(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+
+	// The flag package reports the flag itself, together with the usage of the subcommand.
+	run := runCommand(t, file, "", BalanceCommand, "-bogus")
+	if !errors.Is(run.err, ErrCommandFailed) || !strings.Contains(run.stderr, "flag provided but not defined: -bogus") {
+		t.Errorf("unknown flag wrote %q and returned %v", run.stderr, run.err)
+	}
+	if !strings.Contains(run.stderr, "-card") {
+		t.Errorf("the usage of the subcommand is missing from %q", run.stderr)
+	}
+}
+
+func TestRunCommandErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+
+	// Failures that the subcommand did not report itself make the program log them.
+	for _, args := range [][]string{
+		{"bogus"},
+		{MigrateCommand},
+		{MigrateCommand, "sideways"},
+		{MigrateCommand, MigrateDown, "0"},
+	} {
+		if run := runCommand(t, file, "", args...); run.err == nil || errors.Is(run.err, ErrCommandFailed) {
+			t.Errorf("%v returned %v", args, run.err)
+		}
+	}
+}
+
+func TestCommandMigrate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "card.s3db")
+	latest := bank.LatestSchemaVersion()
+
+	run := runCommand(t, file, "", MigrateCommand, MigrateStatus)
+	if want := fmt.Sprintf(SchemaVersionMsg, 0, latest); run.err != nil || !strings.HasPrefix(run.stdout, want) {
+		t.Fatalf("status of a new database wrote %q and returned %v", run.stdout, run.err)
+	}
+	if pending := strings.Count(run.stdout, "pending"); pending != latest {
+		t.Errorf("%d migrations are pending, want %d", pending, latest)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{MigrateUp}, latest},
+		{[]string{MigrateDown}, latest - DefaultMigrateDownSteps},
+		{[]string{MigrateDown, "2"}, latest - DefaultMigrateDownSteps - 2},
+		{[]string{MigrateUp}, latest},
+	} {
+		args := append([]string{MigrateCommand}, test.args...)
+		run := runCommand(t, file, "", args...)
+		if want := fmt.Sprintf(MigratedMsg, test.want); run.err != nil || run.stdout != want {
+			t.Errorf("%v wrote %q and returned %v, want %q", args, run.stdout, run.err, want)
+		}
+	}
+
+	run = runCommand(t, file, "", MigrateCommand, MigrateStatus)
+	if run.err != nil || strings.Contains(run.stdout, "pending") {
+		t.Errorf("status of a migrated database wrote %q and returned %v", run.stdout, run.err)
+	}
+}
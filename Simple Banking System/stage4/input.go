@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidChoice is returned by LineReader.ReadChoice when the line is not a menu option.
+var ErrInvalidChoice = errors.New("not a menu option")
+
+// LineReader reads the answers typed at the prompts of the menu, one line at a time.
+type LineReader struct {
+	scanner *bufio.Scanner
+	ended   bool
+}
+
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{scanner: bufio.NewScanner(r)}
+}
+
+// ReadLine returns the next line without its surrounding whitespace. It returns io.EOF once the
+// input has ended, and keeps returning it or the read error from then on.
+func (r *LineReader) ReadLine() (string, error) {
+	if !r.scanner.Scan() {
+		r.ended = true
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSpace(r.scanner.Text()), nil
+}
+
+// Ended reports whether the input has ended or failed, so that no prompt can be answered anymore.
+func (r *LineReader) Ended() bool {
+	return r.ended
+}
+
+// ReadChoice reads a menu option, which must be a number alone on its line, or fails with
+// ErrInvalidChoice.
+func (r *LineReader) ReadChoice() (int, error) {
+	line, err := r.ReadLine()
+	if err != nil {
+		return 0, err
+	}
+	choice, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, ErrInvalidChoice
+	}
+	return choice, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"stage4/bank"
+	"strings"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	input := NewLineReader(strings.NewReader("  4000000000000002 \n\nabc\n1 2\n 7\n0"))
+
+	for _, want := range []string{"4000000000000002", ""} {
+		if line, err := input.ReadLine(); line != want || err != nil {
+			t.Errorf("ReadLine() = %q, %v, want %q", line, err, want)
+		}
+	}
+	for _, want := range []struct {
+		choice int
+		err    error
+	}{{0, ErrInvalidChoice}, {0, ErrInvalidChoice}, {7, nil}, {0, nil}, {0, io.EOF}} {
+		if choice, err := input.ReadChoice(); choice != want.choice || !errors.Is(err, want.err) {
+			t.Errorf("ReadChoice() = %d, %v, want %d, %v", choice, err, want.choice, want.err)
+		}
+	}
+	if !input.Ended() {
+		t.Errorf("input has not ended after EOF")
+	}
+	if _, err := input.ReadLine(); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadLine() after EOF failed with %v, want %v", err, io.EOF)
+	}
+}
+
+func TestMenuEndsWithInput(t *testing.T) {
+	for name, script := range map[string]string{
+		"main menu":    "",
+		"wrong option": "abc\n",
+		"login":        "2\n4000000000000002\n",
+		"create":       "1\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			service := bank.NewService(bank.NewMemoryCardRepository(), bank.DefaultConfig())
+			NewBankingSystem(service, bank.DefaultCurrency, strings.NewReader(script), &out).Start()
+
+			if !strings.HasSuffix(out.String(), "\n"+GoodbyeMsg+"\n") {
+				t.Errorf("menu did not say goodbye at the end of the input:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestMenuRepromptsOnWrongOption(t *testing.T) {
+	var out strings.Builder
+	service := bank.NewService(bank.NewMemoryCardRepository(), bank.DefaultConfig())
+	NewBankingSystem(service, bank.DefaultCurrency, strings.NewReader("abc\n1 2\n\n0\n"), &out).Start()
+
+	if got := strings.Count(out.String(), WrongOptionMsg); got != 3 {
+		t.Errorf("%q was displayed %d times, want 3:\n%s", WrongOptionMsg, got, out.String())
+	}
+	if strings.Contains(out.String(), CardCreatedMsg) {
+		t.Errorf("a wrong option created a card:\n%s", out.String())
+	}
+}
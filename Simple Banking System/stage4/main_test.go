@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"stage4/bank"
+	"testing"
+)
+
+func TestErrorMessage(t *testing.T) {
+	usd := func(amount int64) bank.Money { return bank.Money{Amount: amount, Currency: "USD"} }
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		// Wrapped errors are recognized as well.
+		{fmt.Errorf("cannot transfer: %w", bank.ErrInsufficientFunds), NotEnoughMoneyMsg},
+		{&bank.InsufficientFundsError{CardNumber: "4000000000000002", Balance: usd(1), Amount: usd(2)}, NotEnoughMoneyMsg},
+		{bank.ErrWrongCredentials, WrongCredentialsMsg},
+		{bank.ErrSameAccount, TransferToSameAccountMsg},
+		{fmt.Errorf("%w: bad check digit", bank.ErrInvalidCardNumber), TransferToInvalidAccountMsg},
+		{bank.ErrCardNotFound, CardNotFoundMsg},
+		{bank.ErrAccountClosed, AccountClosedMsg},
+		{bank.ErrInvalidAmount, InvalidAmountMsg},
+		{bank.ErrAmountOverflow, AmountOverflowMsg},
+		{&bank.AmountLimitError{Amount: usd(5), Limit: big.NewRat(1, 1), Minimum: true}, fmt.Sprintf(AmountTooSmallMsg, "1.00 USD")},
+		{&bank.AmountLimitError{Amount: usd(50000), Limit: big.NewRat(100, 1)}, fmt.Sprintf(AmountTooLargeMsg, "100.00 USD")},
+		{&bank.WithdrawalLimitError{Amount: usd(500), Limit: usd(300)}, fmt.Sprintf(WithdrawalLimitMsg, "3.00 USD")},
+		{&bank.WithdrawalLimitError{Amount: usd(500), Limit: usd(1000), Daily: true, Remaining: usd(200)},
+			fmt.Sprintf(DailyWithdrawalLimitMsg, "10.00 USD", "2.00 USD")},
+		{errors.New("disk full"), "fallback"},
+	} {
+		if got := errorMessage(test.err, "fallback"); got != test.want {
+			t.Errorf("message of %v is %q, want %q", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"stage4/bank"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Screens repeated in the transcripts
+const (
+	mainMenu = MainMenuCreateAccount + "\n" + MainMenuLogin + "\n" + MenuExit + "\n"
+
+	accountMenu = "\n" + AccountOperationsBalance + "\n" + AccountOperationsAddIncome + "\n" +
+		AccountOperationsDoTransfer + "\n" + AccountOperationsCloseAccount + "\n" + AccountOperationsLogout + "\n" +
+		AccountOperationsHistory + "\n" + AccountOperationsWithdraw + "\n" + AccountOperationsOpenCard + "\n" +
+		AccountOperationsOwnTransfer + "\n" + AccountOperationsReportLost + "\n" + AccountOperationsReissue + "\n" +
+		AccountOperationsSchedule + "\n" + AccountOperationsStatement + "\n" + MenuExit + "\n"
+
+	loginScreen = "\n" + CardNumberPrompt + "\n" + PINPrompt + "\n\n" + LoggedInMsg + "\n"
+
+	goodbye = "\n" + GoodbyeMsg + "\n"
+
+	// timestampPlaceholder replaces the times of day in transcripts, which cannot be predicted.
+	timestampPlaceholder = "<time>"
+)
+
+var timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`)
+
+// menuSession is a bank stored in a temporary SQLite database, driven through its menu.
+type menuSession struct {
+	t       *testing.T
+	service *bank.Service
+}
+
+func newMenuSession(t *testing.T) *menuSession {
+	t.Helper()
+	return newConfiguredMenuSession(t, bank.DefaultConfig())
+}
+
+func newConfiguredMenuSession(t *testing.T, config bank.Config) *menuSession {
+	t.Helper()
+
+	cards, err := bank.OpenRepository("sqlite:" + filepath.Join(t.TempDir(), "card.db"))
+	if err != nil {
+		t.Fatalf("cannot open repository: %v", err)
+	}
+	return &menuSession{t: t, service: bank.NewService(cards, config)}
+}
+
+// createCard creates a card without going through the menu and returns its number and PIN.
+func (s *menuSession) createCard() (string, string) {
+	s.t.Helper()
+
+	card, pin, err := s.service.CreateAccount(bank.DefaultCurrency, "")
+	if err != nil {
+		s.t.Fatalf("cannot create card: %v", err)
+	}
+	return card.Number, pin
+}
+
+// run runs the menu with lines as its input and returns its output, with timestampPlaceholder in
+// place of the times.
+func (s *menuSession) run(lines ...string) string {
+	var out strings.Builder
+	input := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	NewBankingSystem(s.service, bank.DefaultCurrency, input, &out).Start()
+	return timestampPattern.ReplaceAllString(out.String(), timestampPlaceholder)
+}
+
+// expectTranscript runs the menu with lines as its input and checks that its output is want.
+func (s *menuSession) expectTranscript(want string, lines ...string) {
+	s.t.Helper()
+
+	if got := s.run(lines...); got != want {
+		s.t.Errorf("transcript differs\n--- got:\n%s\n--- want:\n%s", got, want)
+	}
+}
+
+func (s *menuSession) expectBalance(number string, want string) {
+	s.t.Helper()
+
+	balance, err := s.service.Balance(number)
+	if err != nil {
+		s.t.Fatalf("cannot load balance of card %s: %v", number, err)
+	}
+	if balance.String() != want {
+		s.t.Errorf("balance of card %s is %v, want %s", number, balance, want)
+	}
+}
+
+// withWrongCheckDigit returns number with its last digit replaced so that the Luhn check fails.
+func withWrongCheckDigit(number string) string {
+	last := number[len(number)-1]
+	return number[:len(number)-1] + string('0'+(last-'0'+1)%10)
+}
+
+func balanceScreen(balance string) string {
+	return "\n" + fmt.Sprintf(BalanceMsg, balance) + "\n"
+}
+
+func TestMenuCreateAccount(t *testing.T) {
+	s := newMenuSession(t)
+
+	got := s.run("1", "0")
+	match := regexp.MustCompile(`Your card number:\n(\d+)\nYour card PIN:\n(\d+)\n`).FindStringSubmatch(got)
+	if match == nil {
+		t.Fatalf("no card number and PIN in the transcript:\n%s", got)
+	}
+	number, pin := match[1], match[2]
+
+	want := mainMenu +
+		"\n" + CardCreatedMsg + "\n" +
+		"Your card number:\n" + number + "\n" +
+		"Your card PIN:\n" + pin + "\n\n" +
+		mainMenu +
+		goodbye
+	if got != want {
+		t.Errorf("transcript differs\n--- got:\n%s\n--- want:\n%s", got, want)
+	}
+
+	if _, err := s.service.Authenticate(number, pin); err != nil {
+		t.Errorf("cannot log into the created card: %v", err)
+	}
+	s.expectBalance(number, "0.00 "+bank.DefaultCurrency)
+}
+
+func TestMenuCreateAccountFailure(t *testing.T) {
+	s := newMenuSession(t)
+
+	// A currency the bank does not support makes the card fail to be created.
+	var out strings.Builder
+	NewBankingSystem(s.service, "XXX", strings.NewReader("1\n0\n"), &out).Start()
+	if want := mainMenu + "\n" + CardFailedMsg + "\n" + mainMenu + goodbye; out.String() != want {
+		t.Errorf("transcript differs\n--- got:\n%s\n--- want:\n%s", out.String(), want)
+	}
+}
+
+func TestMenuCreateAccountChoosesProduct(t *testing.T) {
+	config := bank.DefaultConfig()
+	config.IssuerProfiles = bank.IssuerProfiles{
+		bank.DefaultIssuerProfile(),
+		{Product: "gold", BIN: "51234", Length: 19, PINLength: 6},
+	}
+	s := newConfiguredMenuSession(t, config)
+
+	got := s.run("1", "3", "2", "0")
+	match := regexp.MustCompile(`Your card number:\n(\d+)\nYour card PIN:\n(\d+)\n`).FindStringSubmatch(got)
+	if match == nil {
+		t.Fatalf("no card number and PIN in the transcript:\n%s", got)
+	}
+	number, pin := match[1], match[2]
+
+	productMenu := "\n" + ProductPrompt + "\n1. classic\n2. gold\n"
+	want := mainMenu +
+		productMenu + "\n" + WrongOptionMsg + "\n" +
+		productMenu +
+		"\n" + CardCreatedMsg + "\n" +
+		"Your card number:\n" + number + "\n" +
+		"Your card PIN:\n" + pin + "\n\n" +
+		mainMenu +
+		goodbye
+	if got != want {
+		t.Errorf("transcript differs\n--- got:\n%s\n--- want:\n%s", got, want)
+	}
+
+	card, err := s.service.Authenticate(number, pin)
+	if err != nil {
+		t.Fatalf("cannot log into the created card: %v", err)
+	}
+	if card.Product != "gold" || !strings.HasPrefix(number, "51234") || len(number) != 19 || len(pin) != 6 {
+		t.Errorf("created card is %s %s with PIN %s, want a gold card", card.Product, number, pin)
+	}
+}
+
+func TestMenuLogin(t *testing.T) {
+	s := newMenuSession(t)
+	number, pin := s.createCard()
+
+	t.Run("wrong PIN", func(t *testing.T) {
+		wrongPIN := "0000"
+		if pin == wrongPIN {
+			wrongPIN = "1111"
+		}
+		s.expectTranscript(mainMenu+
+			"\n"+CardNumberPrompt+"\n"+PINPrompt+"\n"+
+			"\n"+WrongCredentialsMsg+"\n"+
+			mainMenu+goodbye,
+			"2", number, wrongPIN, "0")
+	})
+
+	t.Run("log out", func(t *testing.T) {
+		s.expectTranscript(mainMenu+
+			loginScreen+accountMenu+
+			"\n"+LoggedOutMsg+"\n"+
+			mainMenu+goodbye,
+			"2", number, pin, "5", "0")
+	})
+
+	t.Run("exit", func(t *testing.T) {
+		s.expectTranscript(mainMenu+loginScreen+accountMenu+goodbye,
+			"2", number, pin, "0")
+	})
+}
+
+func TestMenuBalanceAndIncome(t *testing.T) {
+	s := newMenuSession(t)
+	number, pin := s.createCard()
+
+	s.expectTranscript(mainMenu+loginScreen+
+		accountMenu+balanceScreen("0.00 USD")+
+		accountMenu+IncomePrompt+"\n"+IncomeAddedMsg+"\n"+
+		accountMenu+IncomePrompt+"\n"+AmountFormatMsg+"\n"+IncomeAddedMsg+"\n"+
+		accountMenu+balanceScreen("12.75 USD")+
+		accountMenu+goodbye,
+		"2", number, pin, "1", "2", "12.50", "2", "a quarter", "0.25", "1", "0")
+
+	s.expectBalance(number, "12.75 USD")
+}
+
+func TestMenuTransfer(t *testing.T) {
+	s := newMenuSession(t)
+	sender, pin := s.createCard()
+	recipient, _ := s.createCard()
+
+	transfer := func(recipient string, answers ...string) []string {
+		return append([]string{"3", recipient}, answers...)
+	}
+	var input []string
+	input = append(input, "2", sender, pin, "2", "100")
+	input = append(input, transfer(recipient, "30")...)
+	input = append(input, transfer(recipient, "70.01")...)
+	input = append(input, transfer(sender)...)
+	input = append(input, transfer(withWrongCheckDigit(recipient))...)
+	input = append(input, "1", "0")
+
+	s.expectTranscript(mainMenu+loginScreen+
+		accountMenu+IncomePrompt+"\n"+IncomeAddedMsg+"\n"+
+		accountMenu+TransferPrompt+"\n"+TransferAmountPrompt+"\n"+TransferSuccessfulMsg+"\n"+
+		accountMenu+TransferPrompt+"\n"+TransferAmountPrompt+"\n"+NotEnoughMoneyMsg+"\n"+
+		accountMenu+TransferPrompt+"\n"+TransferToSameAccountMsg+"\n"+
+		accountMenu+TransferPrompt+"\n"+TransferToInvalidAccountMsg+"\n"+
+		accountMenu+balanceScreen("70.00 USD")+
+		accountMenu+goodbye,
+		input...)
+
+	s.expectBalance(sender, "70.00 USD")
+	s.expectBalance(recipient, "30.00 USD")
+}
+
+func TestMenuTransferToUnknownCard(t *testing.T) {
+	s := newMenuSession(t)
+	sender, pin := s.createCard()
+
+	s.expectTranscript(mainMenu+loginScreen+
+		accountMenu+TransferPrompt+"\n"+CardNotFoundMsg+"\n"+
+		accountMenu+goodbye,
+		"2", sender, pin, "3", "4000000000000002", "0")
+}
+
+func TestMenuCloseAccount(t *testing.T) {
+	s := newMenuSession(t)
+	number, pin := s.createCard()
+	payout, _ := s.createCard()
+
+	s.expectTranscript(mainMenu+loginScreen+
+		accountMenu+IncomePrompt+"\n"+IncomeAddedMsg+"\n"+
+		accountMenu+"Your balance is 5.00 USD. Enter the card number to pay it out to:\n"+
+		"\nClosing statement for card "+number+"\n"+
+		"Opened: <time>\n"+
+		"Closed: <time> ("+CloseReasonCardHolder+")\n"+
+		"<time>  income    credit  5.00 USD  external\n"+
+		"<time>  payout    debit   5.00 USD  "+payout+"\n"+
+		"Total credits: 5.00 USD\n"+
+		"Total debits: 5.00 USD\n"+
+		"Paid out 5.00 USD to card "+payout+"\n"+
+		"Closing balance: 0.00 USD\n"+
+		CloseAccountMsg+"\n"+
+		mainMenu+
+		"\n"+CardNumberPrompt+"\n"+PINPrompt+"\n"+
+		"\n"+AccountClosedMsg+"\n"+
+		mainMenu+goodbye,
+		"2", number, pin, "2", "5", "4", payout, "2", number, pin, "0")
+
+	s.expectBalance(payout, "5.00 USD")
+}
+
+func TestMenuCustomerCards(t *testing.T) {
+	s := newMenuSession(t)
+	number, pin := s.createCard()
+
+	got := s.run("2", number, pin,
+		"9",
+		"8", "Ada Lovelace", "ada@example.com", "",
+		"2", "10",
+		"9", "2", "1", "4",
+		"0")
+	match := regexp.MustCompile(`Your card number:\n(\d+)\nYour card PIN:\n(\d+)\n`).FindStringSubmatch(got)
+	if match == nil {
+		t.Fatalf("no card number and PIN in the transcript:\n%s", got)
+	}
+	second, secondPIN := match[1], match[2]
+
+	ownCards := "\n" + OwnCardsPrompt + "\n1. " + second + "  0.00 USD\n"
+	want := mainMenu + loginScreen +
+		accountMenu + "\n" + NoOtherCardsMsg + "\n" +
+		accountMenu + "\n" + RegisterCustomerMsg + "\n" +
+		CustomerNamePrompt + "\n" + CustomerEmailPrompt + "\n" + CustomerPhonePrompt + "\n" +
+		"\nYou are registered as Ada Lovelace.\n" +
+		"\n" + CardCreatedMsg + "\n" +
+		"Your card number:\n" + second + "\n" +
+		"Your card PIN:\n" + secondPIN + "\n\n" +
+		accountMenu + IncomePrompt + "\n" + IncomeAddedMsg + "\n" +
+		accountMenu + ownCards + "\n" + WrongOptionMsg + "\n" +
+		ownCards + TransferAmountPrompt + "\n" + TransferSuccessfulMsg + "\n" +
+		accountMenu + goodbye
+	if got != want {
+		t.Errorf("transcript differs\n--- got:\n%s\n--- want:\n%s", got, want)
+	}
+
+	s.expectBalance(number, "6.00 USD")
+	s.expectBalance(second, "4.00 USD")
+
+	// The second card opens further cards without registering again.
+	got = s.run("2", second, secondPIN, "8", "0")
+	if !strings.Contains(got, accountMenu+"\n"+CardCreatedMsg+"\n") {
+		t.Errorf("opening a card of a registered customer asked for more:\n%s", got)
+	}
+}
+
+func TestMenuReplaceCard(t *testing.T) {
+	s := newMenuSession(t)
+	number, pin := s.createCard()
+
+	got := s.run("2", number, pin, "2", "10", "10", "11", "1", "0")
+	matches := regexp.MustCompile(`Your card number:\n(\d+)\nYour card PIN:\n(\d+)\n`).FindAllStringSubmatch(got, -1)
+	if len(matches) != 2 {
+		t.Fatalf("no two new cards in the transcript:\n%s", got)
+	}
+	reissued, reissuedPIN := matches[0][1], matches[0][2]
+	replacement, replacementPIN := matches[1][1], matches[1][2]
+
+	newCard := func(number, pin string) string {
+		return "\n" + CardReissuedMsg + "\n" + "Your card number:\n" + number + "\n" + "Your card PIN:\n" + pin + "\n\n"
+	}
+	want := mainMenu + loginScreen +
+		accountMenu + IncomePrompt + "\n" + IncomeAddedMsg + "\n" +
+		accountMenu + "\n" + CardLostMsg + "\n" + newCard(reissued, reissuedPIN) +
+		accountMenu + newCard(replacement, replacementPIN) +
+		accountMenu + balanceScreen("10.00 USD") +
+		accountMenu + goodbye
+	if got != want {
+		t.Errorf("transcript differs\n--- got:\n%s\n--- want:\n%s", got, want)
+	}
+
+	s.expectBalance(replacement, "10.00 USD")
+	for _, old := range []struct{ number, pin, message string }{
+		{number, pin, CardReportedLostMsg},
+		{reissued, reissuedPIN, CardReplacedMsg},
+	} {
+		s.expectTranscript(mainMenu+
+			"\n"+CardNumberPrompt+"\n"+PINPrompt+"\n"+
+			"\n"+old.message+"\n"+
+			mainMenu+goodbye,
+			"2", old.number, old.pin, "0")
+	}
+}
+
+func TestMenuScheduleTransfer(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 9, 0, 0, 0, time.UTC)
+	config := bank.DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	s := newConfiguredMenuSession(t, config)
+	number, pin := s.createCard()
+	recipient, _ := s.createCard()
+
+	schedules := "\n" + SchedulePrompt + "\n" +
+		"1. once\n2. daily\n3. weekly\n4. monthly\n"
+	s.expectTranscript(mainMenu+loginScreen+
+		accountMenu+IncomePrompt+"\n"+IncomeAddedMsg+"\n"+
+		accountMenu+TransferPrompt+"\n"+TransferAmountPrompt+"\n"+schedules+
+		StartDatePrompt+"\n"+DateFormatMsg+"\n"+
+		ScheduleInPastMsg+"\n"+
+		accountMenu+TransferPrompt+"\n"+TransferAmountPrompt+"\n"+schedules+StartDatePrompt+"\n"+
+		fmt.Sprintf(TransferScheduledMsg, "10.00 USD", recipient, "monthly", "2030-01-31")+
+		accountMenu+goodbye,
+		"2", number, pin, "2", "100",
+		"12", recipient, "10", "1", "31/01/2030", "2030-01-14",
+		"12", recipient, "10", "4", "2030-01-31",
+		"0")
+
+	now = time.Date(2030, time.March, 1, 0, 0, 0, 0, time.UTC)
+	runs, err := s.service.RunDueTransfers()
+	if err != nil {
+		t.Fatalf("cannot run the due transfers: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Errorf("ran %d transfers, want the ones of January 31 and February 28", len(runs))
+	}
+	s.expectBalance(number, "80.00 USD")
+	s.expectBalance(recipient, "20.00 USD")
+}
+
+func TestMenuStatementOfCurrentMonth(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 9, 0, 0, 0, time.UTC)
+	config := bank.DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	s := newConfiguredMenuSession(t, config)
+	number, pin := s.createCard()
+
+	// The current month is the one of the clock of the service.
+	got := s.run("2", number, pin, "2", "100", "13", "", "0")
+	if want := fmt.Sprintf(MonthlyStatementMsg, number, "January 2030", "0.00 USD"); !strings.Contains(got, want) {
+		t.Errorf("transcript does not contain %q:\n%s", want, got)
+	}
+	if want := fmt.Sprintf(MonthlyTotalsMsg, "100.00 USD", "0.00 USD", "0.00 USD", "100.00 USD"); !strings.Contains(got, want) {
+		t.Errorf("transcript does not contain %q:\n%s", want, got)
+	}
+}
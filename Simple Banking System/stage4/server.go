@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"stage4/bank"
+	"time"
+)
+
+// API routes. Every route except card creation authenticates the card with HTTP Basic
+// authentication, using the card number as the user name and the PIN as the password.
+const (
+	CardsRoute        = "/cards"
+	AuthRoute         = "/auth"
+	BalanceRoute      = "/balance"
+	IncomeRoute       = "/income"
+	TransfersRoute    = "/transfers"
+	CardRoute         = "/card"
+	TransactionsRoute = "/transactions"
+	WithdrawalsRoute  = "/withdrawals"
+	LimitsRoute       = "/withdrawal-limits"
+	StatementsRoute   = "/statements"
+)
+
+// StatementMonthLayout is the layout of the months of the monthly statements, e.g. 2024-01.
+const StatementMonthLayout = "2006-01"
+
+const authRealm = `Basic realm="Simple Banking System"`
+
+// CreateCardRequest is the optional body of a card creation request. An empty Product selects
+// the default issuer profile.
+type CreateCardRequest struct {
+	Currency string `json:"currency"`
+	Product  string `json:"product"`
+}
+
+type CardResponse struct {
+	Number   string `json:"number"`
+	PIN      string `json:"pin,omitempty"`
+	Currency string `json:"currency"`
+	Product  string `json:"product"`
+}
+
+// NewCardResponse describes card, with its PIN when it is not empty.
+func NewCardResponse(card *bank.Card, pin string) CardResponse {
+	return CardResponse{Number: card.Number, PIN: pin, Currency: card.Currency, Product: card.Product}
+}
+
+// Amounts of money are exchanged as decimal strings, e.g. "12.50", in the currency of the card.
+
+type BalanceResponse struct {
+	Number   string `json:"number"`
+	Balance  string `json:"balance"`
+	Currency string `json:"currency"`
+}
+
+type IncomeRequest struct {
+	Amount string `json:"amount"`
+}
+
+type WithdrawalRequest struct {
+	Amount string `json:"amount"`
+}
+
+// WithdrawalLimits carries the limits of a card; a null limit falls back to the server default.
+type WithdrawalLimits struct {
+	PerWithdrawal *string `json:"perWithdrawal"`
+	Daily         *string `json:"daily"`
+}
+
+type TransferRequest struct {
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+}
+
+type TransactionResponse struct {
+	Reference    string    `json:"reference"`
+	Kind         string    `json:"kind"`
+	Entry        string    `json:"entry"`
+	Amount       string    `json:"amount"`
+	Currency     string    `json:"currency"`
+	Rate         string    `json:"rate,omitempty"`
+	Counterparty string    `json:"counterparty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CloseCardRequest is the optional body of an account closure; PayoutCard is required when the
+// balance is not zero.
+type CloseCardRequest struct {
+	Reason     string `json:"reason"`
+	PayoutCard string `json:"payoutCard"`
+}
+
+type StatementResponse struct {
+	Number     string                `json:"number"`
+	Reason     string                `json:"reason"`
+	OpenedAt   time.Time             `json:"openedAt"`
+	ClosedAt   time.Time             `json:"closedAt"`
+	Entries    []TransactionResponse `json:"entries"`
+	Credits    string                `json:"credits"`
+	Debits     string                `json:"debits"`
+	Currency   string                `json:"currency"`
+	Payout     string                `json:"payout,omitempty"`
+	PayoutCard string                `json:"payoutCard,omitempty"`
+}
+
+// MonthlyStatementResponse is the statement of a calendar month, in UTC.
+type MonthlyStatementResponse struct {
+	Number   string                `json:"number"`
+	Month    string                `json:"month"`
+	Opening  string                `json:"opening"`
+	Entries  []TransactionResponse `json:"entries"`
+	Credits  string                `json:"credits"`
+	Debits   string                `json:"debits"`
+	Interest string                `json:"interest"`
+	Closing  string                `json:"closing"`
+	Currency string                `json:"currency"`
+}
+
+func NewMonthlyStatementResponse(statement *bank.MonthlyStatement) MonthlyStatementResponse {
+	return MonthlyStatementResponse{
+		Number:   statement.CardNumber,
+		Month:    statement.Month.Format(StatementMonthLayout),
+		Opening:  statement.Opening.Decimal(),
+		Entries:  transactionResponses(statement.Entries),
+		Credits:  statement.Credits.Decimal(),
+		Debits:   statement.Debits.Decimal(),
+		Interest: statement.Interest.Decimal(),
+		Closing:  statement.Closing.Decimal(),
+		Currency: statement.Closing.Currency,
+	}
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type apiHandler struct {
+	service  *bank.Service
+	currency string
+	mux      *http.ServeMux
+}
+
+// NewAPIHandler returns an http.Handler exposing the operations of service as a JSON API.
+// Cards created without choosing a currency hold currency.
+func NewAPIHandler(service *bank.Service, currency string) http.Handler {
+	h := &apiHandler{service: service, currency: currency, mux: http.NewServeMux()}
+	h.mux.HandleFunc(CardsRoute, allow(http.MethodPost, h.createCard))
+	h.mux.HandleFunc(AuthRoute, allow(http.MethodPost, h.authenticated(h.authenticate)))
+	h.mux.HandleFunc(BalanceRoute, allow(http.MethodGet, h.authenticated(h.balance)))
+	h.mux.HandleFunc(IncomeRoute, allow(http.MethodPost, h.authenticated(h.addIncome)))
+	h.mux.HandleFunc(TransfersRoute, allow(http.MethodPost, h.authenticated(h.transfer)))
+	h.mux.HandleFunc(CardRoute, allow(http.MethodDelete, h.authenticated(h.closeCard)))
+	h.mux.HandleFunc(TransactionsRoute, allow(http.MethodGet, h.authenticated(h.transactions)))
+	h.mux.HandleFunc(WithdrawalsRoute, allow(http.MethodPost, h.authenticated(h.withdraw)))
+	h.mux.HandleFunc(LimitsRoute, h.authenticated(h.withdrawalLimits))
+	h.mux.HandleFunc(StatementsRoute, allow(http.MethodGet, h.authenticated(h.statement)))
+	return h
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func allow(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *apiHandler) authenticated(next func(http.ResponseWriter, *http.Request, *bank.Card)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cardNumber, pin, ok := r.BasicAuth()
+		if !ok {
+			h.writeBankingError(w, bank.ErrWrongCredentials)
+			return
+		}
+
+		card, err := h.service.Authenticate(cardNumber, pin)
+		if err != nil {
+			h.writeBankingError(w, err)
+			return
+		}
+
+		next(w, r, card)
+	}
+}
+
+func (h *apiHandler) createCard(w http.ResponseWriter, r *http.Request) {
+	request := CreateCardRequest{Currency: h.currency}
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	card, pin, err := h.service.CreateAccount(request.Currency, request.Product)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, NewCardResponse(card, pin))
+}
+
+func (h *apiHandler) authenticate(w http.ResponseWriter, _ *http.Request, card *bank.Card) {
+	writeJSON(w, http.StatusOK, NewCardResponse(card, ""))
+}
+
+func (h *apiHandler) balance(w http.ResponseWriter, _ *http.Request, card *bank.Card) {
+	balance, err := h.service.Balance(card.Number)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, BalanceResponse{Number: card.Number, Balance: balance.Decimal(), Currency: balance.Currency})
+}
+
+func (h *apiHandler) addIncome(w http.ResponseWriter, r *http.Request, card *bank.Card) {
+	var request IncomeRequest
+	if err := decodeJSON(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	income, err := bank.ParseMoney(request.Amount, card.Currency)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	if err := h.service.Deposit(card, income); err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	h.balance(w, r, card)
+}
+
+func (h *apiHandler) withdraw(w http.ResponseWriter, r *http.Request, card *bank.Card) {
+	var request WithdrawalRequest
+	if err := decodeJSON(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	amount, err := bank.ParseMoney(request.Amount, card.Currency)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	if err := h.service.Withdraw(card, amount); err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	h.balance(w, r, card)
+}
+
+// withdrawalLimits returns the limits of the card on GET and replaces its own limits on PUT.
+func (h *apiHandler) withdrawalLimits(w http.ResponseWriter, r *http.Request, card *bank.Card) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var request WithdrawalLimits
+		if err := decodeJSON(r, &request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var limits [2]*bank.Money
+		for i, value := range []*string{request.PerWithdrawal, request.Daily} {
+			if value == nil {
+				continue
+			}
+			limit, err := bank.ParseMoney(*value, card.Currency)
+			if err != nil {
+				h.writeBankingError(w, err)
+				return
+			}
+			limits[i] = &limit
+		}
+
+		if err := h.service.SetWithdrawalLimits(card, limits[0], limits[1]); err != nil {
+			h.writeBankingError(w, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	perWithdrawal, daily, err := h.service.WithdrawalLimits(card)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	var response WithdrawalLimits
+	if perWithdrawal != nil {
+		value := perWithdrawal.Decimal()
+		response.PerWithdrawal = &value
+	}
+	if daily != nil {
+		value := daily.Decimal()
+		response.Daily = &value
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *apiHandler) transfer(w http.ResponseWriter, r *http.Request, card *bank.Card) {
+	var request TransferRequest
+	if err := decodeJSON(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	amount, err := bank.ParseMoney(request.Amount, card.Currency)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	if err := h.service.Transfer(card, request.To, amount); err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	h.balance(w, r, card)
+}
+
+func (h *apiHandler) closeCard(w http.ResponseWriter, r *http.Request, card *bank.Card) {
+	var request CloseCardRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	statement, err := h.service.Close(card, bank.CloseRequest{Reason: request.Reason, PayoutCardNumber: request.PayoutCard})
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewStatementResponse(statement))
+}
+
+func (h *apiHandler) transactions(w http.ResponseWriter, _ *http.Request, card *bank.Card) {
+	entries, err := h.service.History(card.Number, TransactionHistoryLimit)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transactionResponses(entries))
+}
+
+// statement returns the monthly statement of the month in the month query parameter, e.g.
+// ?month=2024-01, or of the current month.
+func (h *apiHandler) statement(w http.ResponseWriter, r *http.Request, card *bank.Card) {
+	month := h.service.Now()
+	if value := r.URL.Query().Get("month"); value != "" {
+		var err error
+		if month, err = time.Parse(StatementMonthLayout, value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("the month must look like %s", StatementMonthLayout))
+			return
+		}
+	}
+
+	statement, err := h.service.MonthlyStatement(card, month)
+	if err != nil {
+		h.writeBankingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewMonthlyStatementResponse(statement))
+}
+
+func NewStatementResponse(statement *bank.Statement) StatementResponse {
+	response := StatementResponse{
+		Number:     statement.CardNumber,
+		Reason:     statement.Reason,
+		OpenedAt:   statement.OpenedAt,
+		ClosedAt:   statement.ClosedAt,
+		Entries:    transactionResponses(statement.Entries),
+		Credits:    statement.Credits.Decimal(),
+		Debits:     statement.Debits.Decimal(),
+		Currency:   statement.Credits.Currency,
+		PayoutCard: statement.PayoutCardNumber,
+	}
+	if statement.Payout != nil {
+		response.Payout = statement.Payout.Decimal()
+	}
+	return response
+}
+
+func transactionResponses(entries []bank.Transaction) []TransactionResponse {
+	response := make([]TransactionResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, TransactionResponse{
+			Reference:    entry.Reference,
+			Kind:         entry.Kind,
+			Entry:        entry.Entry,
+			Amount:       entry.Money().Decimal(),
+			Currency:     entry.Currency,
+			Rate:         entry.Rate,
+			Counterparty: entry.Counterparty,
+			CreatedAt:    entry.CreatedAt,
+		})
+	}
+	return response
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// writeBankingError maps the failures of the Banking System operations to HTTP status codes.
+// Retry-After counts down the lockout by the clock of the Service, which timed it.
+func (h *apiHandler) writeBankingError(w http.ResponseWriter, err error) {
+	var blocked *bank.CardBlockedError
+	switch {
+	case errors.Is(err, bank.ErrWrongCredentials):
+		w.Header().Set("WWW-Authenticate", authRealm)
+		writeError(w, http.StatusUnauthorized, err)
+	case errors.As(err, &blocked):
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", blocked.Until.Sub(h.service.Now()).Seconds()+1))
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, bank.ErrCardNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, bank.ErrAccountClosed), errors.Is(err, bank.ErrCardLost), errors.Is(err, bank.ErrCardReplaced):
+		writeError(w, http.StatusGone, err)
+	case errors.Is(err, bank.ErrInvalidAmount), errors.Is(err, bank.ErrInvalidMoney),
+		errors.Is(err, bank.ErrAmountOverflow), errors.Is(err, bank.ErrCurrencyMismatch),
+		errors.Is(err, bank.ErrUnknownCurrency), errors.Is(err, bank.ErrAmountLimit),
+		errors.Is(err, bank.ErrUnknownProduct):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, bank.ErrSameAccount), errors.Is(err, bank.ErrInvalidCardNumber),
+		errors.Is(err, bank.ErrNoExchangeRate), errors.Is(err, bank.ErrWithdrawalLimit):
+		writeError(w, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, bank.ErrInsufficientFunds), errors.Is(err, bank.ErrBalanceRemaining),
+		errors.Is(err, bank.ErrAccountNotClosed):
+		writeError(w, http.StatusConflict, err)
+	default:
+		log.Printf("API request failed: %v\n", err)
+		writeError(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("cannot write API response: %v\n", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"stage4/bank"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiSession is a bank in a temporary database, driven through its JSON API.
+type apiSession struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+func newAPISession(t *testing.T, config bank.Config) *apiSession {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "card.s3db")), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	cards, err := bank.NewGormCardRepository(db)
+	if err != nil {
+		t.Fatalf("cannot prepare database: %v", err)
+	}
+	return &apiSession{t: t, handler: NewAPIHandler(bank.NewService(cards, config), bank.DefaultCurrency)}
+}
+
+// request sends body, unless it is empty, to route as the card with number and pin, unless
+// number is empty, checks that the response has status want and decodes it into response.
+func (s *apiSession) request(method, route, number, pin, body string, want int, response any) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	r := httptest.NewRequest(method, route, strings.NewReader(body))
+	if number != "" {
+		r.SetBasicAuth(number, pin)
+	}
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+
+	if w.Code != want {
+		s.t.Fatalf("%s %s answered %d %s, want %d", method, route, w.Code, w.Body, want)
+	}
+	if response != nil {
+		if content := w.Header().Get("Content-Type"); content != "application/json" {
+			s.t.Errorf("%s %s answered with content type %q", method, route, content)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+			s.t.Fatalf("cannot decode the answer to %s %s: %v", method, route, err)
+		}
+	}
+	return w
+}
+
+func (s *apiSession) createCard() CardResponse {
+	s.t.Helper()
+
+	var card CardResponse
+	s.request(http.MethodPost, CardsRoute, "", "", "", http.StatusCreated, &card)
+	return card
+}
+
+func TestAPIOperations(t *testing.T) {
+	s := newAPISession(t, bank.DefaultConfig())
+	card, recipient := s.createCard(), s.createCard()
+	if card.PIN == "" {
+		t.Fatalf("created card %+v, want it with its PIN", card)
+	}
+
+	var authenticated CardResponse
+	s.request(http.MethodPost, AuthRoute, card.Number, card.PIN, "", http.StatusOK, &authenticated)
+	if authenticated.Number != card.Number || authenticated.PIN != "" {
+		t.Errorf("authenticated as %+v, want %s without its PIN", authenticated, card.Number)
+	}
+
+	var balance BalanceResponse
+	s.request(http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": "100"}`, http.StatusOK, &balance)
+	if balance.Balance != "100.00" || balance.Currency != bank.DefaultCurrency {
+		t.Errorf("balance is %s %s after the income, want 100.00 %s", balance.Balance, balance.Currency, bank.DefaultCurrency)
+	}
+	s.request(http.MethodPost, TransfersRoute, card.Number, card.PIN,
+		`{"to": "`+recipient.Number+`", "amount": "30.50"}`, http.StatusOK, &balance)
+	if balance.Balance != "69.50" {
+		t.Errorf("balance is %s after the transfer, want 69.50", balance.Balance)
+	}
+	s.request(http.MethodGet, BalanceRoute, recipient.Number, recipient.PIN, "", http.StatusOK, &balance)
+	if balance.Balance != "30.50" {
+		t.Errorf("recipient balance is %s, want 30.50", balance.Balance)
+	}
+
+	var entries []TransactionResponse
+	s.request(http.MethodGet, TransactionsRoute, card.Number, card.PIN, "", http.StatusOK, &entries)
+	if len(entries) != 2 || entries[0].Kind != bank.KindTransfer || entries[0].Counterparty != recipient.Number || entries[0].Amount != "30.50" {
+		t.Errorf("transactions are %+v, want the transfer then the income", entries)
+	}
+
+	s.request(http.MethodDelete, CardRoute, recipient.Number, recipient.PIN, "", http.StatusConflict, nil)
+	var statement StatementResponse
+	s.request(http.MethodDelete, CardRoute, recipient.Number, recipient.PIN,
+		`{"reason": "moving", "payoutCard": "`+card.Number+`"}`, http.StatusOK, &statement)
+	if statement.Payout != "30.50" || statement.PayoutCard != card.Number || statement.Credits != "30.50" || statement.Debits != "30.50" {
+		t.Errorf("closing statement is %+v, want 30.50 in and paid out to %s", statement, card.Number)
+	}
+	s.request(http.MethodGet, BalanceRoute, recipient.Number, recipient.PIN, "", http.StatusGone, nil)
+}
+
+func TestAPIErrorStatuses(t *testing.T) {
+	s := newAPISession(t, bank.DefaultConfig())
+	card, recipient := s.createCard(), s.createCard()
+	s.request(http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": "10"}`, http.StatusOK, nil)
+
+	for _, test := range []struct {
+		method, route, number, pin, body string
+		want                             int
+	}{
+		{http.MethodGet, BalanceRoute, "", "", "", http.StatusUnauthorized},
+		{http.MethodGet, BalanceRoute, card.Number, "x" + card.PIN, "", http.StatusUnauthorized},
+		{http.MethodGet, CardsRoute, "", "", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, CardsRoute, "", "", `{"currency": "XXX"}`, http.StatusBadRequest},
+		{http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": 10}`, http.StatusBadRequest},
+		{http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": "0"}`, http.StatusBadRequest},
+		{http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": "0.001"}`, http.StatusBadRequest},
+		{http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": "10", "to": "x"}`, http.StatusBadRequest},
+		{http.MethodPost, TransfersRoute, card.Number, card.PIN, `{"to": "` + recipient.Number + `", "amount": "20"}`, http.StatusConflict},
+		{http.MethodPost, TransfersRoute, card.Number, card.PIN, `{"to": "4000000000000003", "amount": "1"}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, TransfersRoute, card.Number, card.PIN, `{"to": "4000000000000002", "amount": "1"}`, http.StatusNotFound},
+		{http.MethodPost, TransfersRoute, card.Number, card.PIN, `{"to": "` + card.Number + `", "amount": "1"}`, http.StatusUnprocessableEntity},
+	} {
+		var failure ErrorResponse
+		s.request(test.method, test.route, test.number, test.pin, test.body, test.want, &failure)
+		if failure.Error == "" {
+			t.Errorf("%s %s answered %d without an error", test.method, test.route, test.want)
+		}
+	}
+}
+
+func TestAPIRetryAfterLockout(t *testing.T) {
+	now := time.Date(2030, time.January, 15, 9, 0, 0, 0, time.UTC)
+	config := bank.DefaultConfig()
+	config.Clock = func() time.Time { return now }
+	s := newAPISession(t, config)
+	card := s.createCard()
+
+	for i := 1; i < bank.DefaultMaxFailedPINAttempts; i++ {
+		s.request(http.MethodGet, BalanceRoute, card.Number, "x"+card.PIN, "", http.StatusUnauthorized, nil)
+	}
+	s.request(http.MethodGet, BalanceRoute, card.Number, "x"+card.PIN, "", http.StatusForbidden, nil)
+
+	// The delay counts down by the clock the lockout is timed by, not by the wall clock.
+	now = now.Add(5 * time.Minute)
+	w := s.request(http.MethodGet, BalanceRoute, card.Number, card.PIN, "", http.StatusForbidden, nil)
+	want := strconv.Itoa(int((bank.DefaultLockoutDuration-5*time.Minute)/time.Second) + 1)
+	if got := w.Header().Get("Retry-After"); got != want {
+		t.Errorf("blocked card answered with Retry-After %q, want %q", got, want)
+	}
+}
+
+func TestAPIWithdrawalLimits(t *testing.T) {
+	s := newAPISession(t, bank.DefaultConfig())
+	card := s.createCard()
+	s.request(http.MethodPost, IncomeRoute, card.Number, card.PIN, `{"amount": "100"}`, http.StatusOK, nil)
+
+	var limits WithdrawalLimits
+	s.request(http.MethodPut, LimitsRoute, card.Number, card.PIN, `{"perWithdrawal": "20", "daily": null}`, http.StatusOK, &limits)
+	if limits.PerWithdrawal == nil || *limits.PerWithdrawal != "20.00" || limits.Daily != nil {
+		t.Errorf("limits are %+v, want 20.00 per withdrawal and no daily limit", limits)
+	}
+	s.request(http.MethodPost, WithdrawalsRoute, card.Number, card.PIN, `{"amount": "20.01"}`, http.StatusUnprocessableEntity, nil)
+
+	var balance BalanceResponse
+	s.request(http.MethodPost, WithdrawalsRoute, card.Number, card.PIN, `{"amount": "20"}`, http.StatusOK, &balance)
+	if balance.Balance != "80.00" {
+		t.Errorf("balance is %s after the withdrawal, want 80.00", balance.Balance)
+	}
+}